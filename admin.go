@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/nobonobo/rccargo/protocol"
+)
+
+var adminToken = flag.String("admin-token", "", "token for admin RPCs (disabled when empty)")
+
+func checkAdmin(token string) error {
+	if *adminToken == "" {
+		return errors.New("admin disabled")
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(*adminToken)) != 1 {
+		return errors.New("admin: bad token")
+	}
+	return nil
+}
+
+// SetWeather ...
+func (w *World) SetWeather(req *protocol.Weather, rep *protocol.Weather) error {
+	if err := checkAdmin(req.Token); err != nil {
+		return err
+	}
+	w.ctx.SetWetness(req.Wetness)
+	*rep = protocol.Weather{Wetness: w.ctx.Wetness()}
+	log.Println("weather: wetness", rep.Wetness)
+	return nil
+}
+
+// Control pauses, resumes, single-steps or rescales the simulation.
+func (w *World) Control(req *protocol.Control, rep *protocol.Control) error {
+	if err := checkAdmin(req.Token); err != nil {
+		return err
+	}
+	switch req.Op {
+	case "pause":
+		w.ctx.Pause()
+	case "resume":
+		w.ctx.Resume()
+	case "step":
+		steps := req.Steps
+		if steps < 0 {
+			return fmt.Errorf("negative steps: %d", steps)
+		}
+		if steps == 0 {
+			steps = 1
+		}
+		w.ctx.StepOnce(steps)
+	case "scale":
+		if err := w.ctx.SetTimeScale(req.TimeScale); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown op: %q", req.Op)
+	}
+	*rep = protocol.Control{Op: req.Op, TimeScale: w.ctx.TimeScale(), Paused: w.ctx.Paused()}
+	log.Println("control:", req.Op, rep.TimeScale, rep.Paused)
+	return nil
+}
+
+// SetTeam puts the player's vehicle in a team of the collision filter.
+func (w *World) SetTeam(req *protocol.Team, rep *int) error {
+	if err := checkAdmin(req.Token); err != nil {
+		return err
+	}
+	if err := w.ctx.SetTeam(req.Name, req.Team); err != nil {
+		return err
+	}
+	*rep = req.Team
+	log.Println("team:", req.Name, req.Team)
+	return nil
+}
+
+// ResetObjects puts every track object back in place and returns how many
+// there are.
+func (w *World) ResetObjects(req *protocol.ObjectReset, rep *int) error {
+	if err := checkAdmin(req.Token); err != nil {
+		return err
+	}
+	*rep = w.ctx.ResetObjects()
+	log.Println("reset objects:", *rep)
+	return nil
+}
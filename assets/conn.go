@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/gopherjs/gopherjs/js"
+)
+
+// conn is a browser websocket as a byte stream for net/rpc. Messages
+// arrive in order and are read back to back.
+type conn struct {
+	ws   *js.Object
+	mu   sync.Mutex
+	cond *sync.Cond
+	buf  []byte
+	err  error
+}
+
+// dial opens a websocket to url offering protocols and waits until it is
+// open. Protocol reports the one the server accepted.
+func dial(url string, protocols ...string) (*conn, error) {
+	c := &conn{ws: js.Global.Get("WebSocket").New(url, protocols)}
+	c.cond = sync.NewCond(&c.mu)
+	c.ws.Set("binaryType", "arraybuffer")
+	open := make(chan error, 1)
+	c.ws.Set("onopen", func() {
+		select {
+		case open <- nil:
+		default:
+		}
+	})
+	c.ws.Set("onerror", func() {
+		select {
+		case open <- errors.New("websocket: connection failed"):
+		default:
+		}
+	})
+	c.ws.Set("onmessage", func(ev *js.Object) {
+		data := ev.Get("data")
+		var b []byte
+		if data.Get("byteLength") == js.Undefined {
+			b = []byte(data.String())
+		} else {
+			b = js.Global.Get("Uint8Array").New(data).Interface().([]byte)
+		}
+		c.mu.Lock()
+		c.buf = append(c.buf, b...)
+		c.cond.Broadcast()
+		c.mu.Unlock()
+	})
+	c.ws.Set("onclose", func() {
+		c.mu.Lock()
+		c.err = io.EOF
+		c.cond.Broadcast()
+		c.mu.Unlock()
+		select {
+		case open <- errors.New("websocket: closed"):
+		default:
+		}
+	})
+	if err := <-open; err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Protocol ...
+func (c *conn) Protocol() string {
+	return c.ws.Get("protocol").String()
+}
+
+func (c *conn) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.buf) == 0 && c.err == nil {
+		c.cond.Wait()
+	}
+	if len(c.buf) == 0 {
+		return 0, c.err
+	}
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+// Write sends p as one binary message.
+func (c *conn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	err := c.err
+	c.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	c.ws.Call("send", js.NewArrayBuffer(p))
+	return len(p), nil
+}
+
+func (c *conn) Close() error {
+	c.ws.Call("close")
+	return nil
+}
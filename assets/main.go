@@ -5,9 +5,10 @@ import (
 	"math"
 	"net/rpc"
 	"net/rpc/jsonrpc"
+	"strings"
+	"time"
 
 	"github.com/gopherjs/gopherjs/js"
-	"github.com/gopherjs/websocket"
 	"github.com/nobonobo/rccargo/protocol"
 )
 
@@ -19,25 +20,30 @@ var (
 	THREE     = js.Global.Get("THREE")
 )
 
-// Start ...
-func Start(c *rpc.Client) {
+// Start joins through c and plays; with push it takes the world from the
+// server's broadcast instead of polling World.Update.
+func Start(c *rpc.Client, push *conn) {
 	axes := []func() float64{
 		func() float64 { return 0.0 },
 		func() float64 { return 0.0 },
 		func() float64 { return 0.0 },
 	}
+	stick := func(i int) float64 { return 0.0 }
 	if f := navigator.Get("getGamepads"); f != js.Undefined {
 		joystick := navigator.Call("getGamepads").Index(0)
 		if joystick != js.Undefined {
 			get := func() *js.Object {
 				return navigator.Call("getGamepads").Index(0)
 			}
+			stick = func(i int) float64 {
+				return get().Get("axes").Index(i).Float()
+			}
 			axes[0] = func() float64 {
 				return get().Get("axes").Index(0).Float()
 			}
 			axes[1] = func() float64 {
 				v := get().Get("axes").Index(3).Float() * -1
-				if v < 0.1 {
+				if v < 0.0 {
 					v = 0.0
 				}
 				return v
@@ -99,6 +105,10 @@ func Start(c *rpc.Client) {
 			func(child *js.Object) {
 				//child.Set("castShadow", true)
 				child.Set("receiveShadow", true)
+				// dynamic objects are simulated and drawn from World.Update
+				if strings.HasPrefix(child.Get("name").String(), "dyn_") {
+					child.Set("visible", false)
+				}
 			},
 		)
 		geoms := collada.Get("loader")
@@ -114,11 +124,16 @@ func Start(c *rpc.Client) {
 	stats.Call("showPanel", 0) // 0: fps, 1: ms, 2: mb, 3+: custom
 	document.Get("body").Call("appendChild", stats.Get("dom"))
 
-	profile := protocol.VehicleProfile{}
+	// ?kind=quadcopter flies a quadcopter instead of driving a car
+	kind := protocol.KindCar
+	if strings.Contains(location.Get("search").String(), "kind="+protocol.KindQuadcopter) {
+		kind = protocol.KindQuadcopter
+	}
+	full := protocol.Profile{}
 	name := ""
 	for i := 1; i <= 20; i++ {
 		name = fmt.Sprintf("player%d", i)
-		if err := c.Call("World.Join", name, &profile); err != nil {
+		if err := c.Call("World.JoinAs", protocol.Join{Name: name, Kind: kind}, &full); err != nil {
 			fmt.Println("rpc failed:", err)
 			continue
 		} else {
@@ -133,8 +148,35 @@ func Start(c *rpc.Client) {
 		res := ""
 		c.Go("World.Bye", name, &res, nil)
 	}, false)
+	profile := full.Vehicle
 	fmt.Println("profile:", profile)
-	build := func(name string) {
+	buildQuadcopter := func(name string) {
+		q := full.Quadcopter
+		geometry := THREE.Get("BoxGeometry").New(q.FrameBox[0], q.FrameBox[1], q.FrameBox[2])
+		material := THREE.Get("MeshStandardMaterial").New(
+			map[string]interface{}{"color": 0xffffff},
+		)
+		body := THREE.Get("Mesh").New(geometry, material)
+		body.Set("name", name)
+		body.Set("castShadow", true)
+		scene.Call("add", body)
+		for i := 0; i < 4; i++ {
+			// a blade across a disc, so the spin shows
+			geometry := THREE.Get("BoxGeometry").New(q.RotorDiameter, q.RotorDiameter/8, 0.002)
+			material := THREE.Get("MeshStandardMaterial").New(
+				map[string]interface{}{"color": 0x8080ff},
+			)
+			rotor := THREE.Get("Mesh").New(geometry, material)
+			rotor.Set("name", fmt.Sprintf("%s-tire%d", name, i))
+			rotor.Set("castShadow", true)
+			scene.Call("add", rotor)
+		}
+	}
+	build := func(name, kind string) {
+		if kind == protocol.KindQuadcopter {
+			buildQuadcopter(name)
+			return
+		}
 		geometry := THREE.Get("BoxGeometry").New(
 			profile.BodyBox[0],
 			profile.BodyBox[1],
@@ -170,9 +212,34 @@ func Start(c *rpc.Client) {
 			scene.Call("add", tire)
 		}
 	}
+	buildObject := func(o *protocol.Object) {
+		var geometry *js.Object
+		switch o.Shape {
+		case "box":
+			geometry = THREE.Get("BoxGeometry").New(o.Size[0], o.Size[1], o.Size[2])
+		case "cylinder":
+			geometry = THREE.Get("CylinderGeometry").New(o.Size[0]/2, o.Size[1]/2, o.Size[2], 16)
+			geometry.Call("rotateX", math.Pi/2)
+		default:
+			geometry = THREE.Get("SphereGeometry").New(o.Size[0]/2, 16, 12)
+		}
+		material := THREE.Get("MeshStandardMaterial").New(
+			map[string]interface{}{"color": 0xff8000},
+		)
+		mesh := THREE.Get("Mesh").New(geometry, material)
+		mesh.Set("name", "object:"+o.Name)
+		mesh.Set("castShadow", true)
+		scene.Call("add", mesh)
+	}
+	if kind == protocol.KindQuadcopter {
+		// mode 2 transmitter: throttle and yaw left, pitch and roll right
+		axes[1] = func() float64 { return math.Max(0, -stick(1)) }
+		axes[2] = func() float64 { return math.Max(0, stick(1)) }
+	}
 	//build(name)
 	steering := axes[0]()
 	accel, brake := axes[1](), axes[2]()
+	pitch, roll := 0.0, 0.0
 	sx, sy := 0.0, 0.0
 	mouse := false
 	apply := func(dx, dy float64) {
@@ -188,6 +255,11 @@ func Start(c *rpc.Client) {
 		if dy > 1 {
 			dy = 1
 		}
+		if kind == protocol.KindQuadcopter {
+			// dragging tilts, the quadcopter holds its height
+			roll, pitch = dx, -dy
+			return
+		}
 		steering = dx
 		if dy < 0.0 {
 			accel = -dy
@@ -199,6 +271,7 @@ func Start(c *rpc.Client) {
 	}
 	cancel := func(ev *js.Object) {
 		mouse = false
+		pitch, roll = 0.0, 0.0
 		steering = axes[0]()
 		accel, brake = axes[1](), axes[2]()
 	}
@@ -245,21 +318,27 @@ func Start(c *rpc.Client) {
 	element.Call("addEventListener", "mouseup", cancel, false)
 	element.Call("addEventListener", "mouseout", cancel, false)
 
-	update := func() error {
+	// kinematics are the animated track nodes, taken out of the track
+	// hierarchy to be placed in world coordinates
+	kinematics := map[string]*js.Object{}
+	read := func() protocol.Input {
 		if !mouse {
 			steering = axes[0]()
 			accel, brake = axes[1](), axes[2]()
+			if kind == protocol.KindQuadcopter {
+				pitch, roll = -stick(3), stick(2)
+			}
 		}
-		in := protocol.Input{
+		return protocol.Input{
 			Name:     name,
 			Steering: steering,
 			Accel:    accel,
 			Brake:    brake,
+			Pitch:    pitch,
+			Roll:     roll,
 		}
-		res := &protocol.Output{}
-		if err := c.Call("World.Update", in, &res); err != nil {
-			return err
-		}
+	}
+	show := func(res *protocol.Output) {
 		move := func(v *protocol.Vehicle) {
 			for i, w := range v.Tires {
 				tire := scene.Call("getObjectByName", fmt.Sprintf("%s-tire%d", v.Name, i))
@@ -294,16 +373,102 @@ func Start(c *rpc.Client) {
 			}
 			body := scene.Call("getObjectByName", vehicle.Name)
 			if body == js.Undefined {
-				build(vehicle.Name)
+				build(vehicle.Name, vehicle.Kind)
+			}
+			if vehicle.Sleeping && len(vehicle.Body.Position) == 0 {
+				continue
 			}
 			move(vehicle)
 		}
+		for _, o := range res.Objects {
+			mesh := scene.Call("getObjectByName", "object:"+o.Name)
+			if mesh == js.Undefined {
+				buildObject(o)
+				mesh = scene.Call("getObjectByName", "object:"+o.Name)
+			}
+			mesh.Get("position").Call("set",
+				o.Body.Position[0],
+				o.Body.Position[1],
+				o.Body.Position[2],
+			)
+			mesh.Get("quaternion").Call("set",
+				o.Body.Quaternion[1],
+				o.Body.Quaternion[2],
+				o.Body.Quaternion[3],
+				o.Body.Quaternion[0],
+			)
+		}
+		for _, k := range res.Kinematics {
+			node := kinematics[k.Name]
+			if node == nil {
+				node = scene.Call("getObjectByName", k.Name)
+				if node == js.Undefined {
+					continue // track not loaded yet
+				}
+				node.Call("updateMatrixWorld", true)
+				scale := THREE.Get("Vector3").New()
+				node.Get("matrixWorld").Call("decompose", THREE.Get("Vector3").New(), THREE.Get("Quaternion").New(), scale)
+				node.Get("parent").Call("remove", node)
+				scene.Call("add", node)
+				node.Get("scale").Call("copy", scale)
+				kinematics[k.Name] = node
+			}
+			node.Get("position").Call("set",
+				k.Body.Position[0],
+				k.Body.Position[1],
+				k.Body.Position[2],
+			)
+			node.Get("quaternion").Call("set",
+				k.Body.Quaternion[1],
+				k.Body.Quaternion[2],
+				k.Body.Quaternion[3],
+				k.Body.Quaternion[0],
+			)
+		}
 		if res.Self != nil {
 			pos := res.Self.Body.Position
 			camera.Call("lookAt", THREE.Get("Vector3").New(pos[0], pos[1], pos[2]))
 		}
+	}
+	update := func() error {
+		res := &protocol.Output{}
+		if err := c.Call("World.Update", read(), &res); err != nil {
+			return err
+		}
+		show(res)
 		return nil
 	}
+	if push != nil {
+		// the server sends the world at its own rate; inputs go out when
+		// they change and often enough to keep the failsafe off
+		go func() {
+			r := protocol.NewMessageReader(push)
+			for {
+				res := &protocol.Output{}
+				if err := r.Read(res); err != nil {
+					fmt.Println("push:", err)
+					return
+				}
+				show(res)
+			}
+		}()
+		keepalive := time.Second
+		if t := time.Duration(full.Failsafe.Timeout / 3 * float64(time.Second)); t > 0 && t < keepalive {
+			keepalive = t
+		}
+		last, sent := protocol.Input{}, time.Time{}
+		update = func() error {
+			in := read()
+			if in == last && time.Since(sent) < keepalive {
+				return nil
+			}
+			if err := protocol.WriteMessage(push, in); err != nil {
+				return err
+			}
+			last, sent = in, time.Now()
+			return nil
+		}
+	}
 
 	ch := make(chan struct{})
 	go func() {
@@ -343,9 +508,22 @@ func main() {
 	if location.Get("origin").Call("lastIndexOf", "https", 0).Int() == 0 {
 		scheme = "wss"
 	}
-	c, err := websocket.Dial(fmt.Sprintf("%s://%s/ws", scheme, location.Get("host")))
+	c, err := dial(fmt.Sprintf("%s://%s/ws", scheme, location.Get("host")), protocol.Subprotocol)
 	if err != nil {
 		fmt.Println(err)
+		return
+	}
+	// ?push takes the world from the server's broadcast
+	var push *conn
+	if strings.Contains(location.Get("search").String(), "push") {
+		if push, err = dial(fmt.Sprintf("%s://%s/push", scheme, location.Get("host"))); err != nil {
+			fmt.Println(err)
+		}
+	}
+	if c.Protocol() == protocol.Subprotocol {
+		Start(rpc.NewClientWithCodec(protocol.NewClientCodec(c)), push)
+		return
 	}
-	Start(jsonrpc.NewClient(c))
+	// server without the binary wire format
+	Start(jsonrpc.NewClient(c), push)
 }
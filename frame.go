@@ -0,0 +1,163 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/nobonobo/rccargo/physics"
+	"github.com/nobonobo/rccargo/protocol"
+)
+
+// frame is the world as of the last physics tick. It is built once per
+// tick and never changed afterwards, so World.Update calls share it
+// without touching the physics lock.
+type frame struct {
+	vehicles   []entry
+	objects    []*protocol.Object
+	kinematics []*protocol.Kinematic
+	timeScale  float64
+	paused     bool
+}
+
+type entry struct {
+	name      string
+	vehicle   *protocol.Vehicle // shared by every viewer, without telemetry
+	telemetry *protocol.Telemetry
+	asleep    *protocol.Vehicle // sent instead once a viewer has it asleep
+}
+
+// viewer is what one player has been sent. It has its own lock so that
+// building outputs never holds up other players or the physics tick.
+type viewer struct {
+	mu     sync.Mutex
+	asleep map[string]bool // sleeping vehicles already sent
+}
+
+// output fills rep with the frame f as seen by the player name.
+func (v *viewer) output(name string, f *frame, rep *protocol.Output) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	f.output(name, v.asleep, rep)
+}
+
+// output fills rep with f as seen by the player name. Only the player's
+// own vehicle carries telemetry. Vehicles asleep in sent are sent as
+// stubs; sent is updated, nil sends every vehicle in full.
+func (f *frame) output(name string, sent map[string]bool, rep *protocol.Output) {
+	for _, e := range f.vehicles {
+		sleeping := e.vehicle.Sleeping
+		if e.name == name {
+			self := *e.vehicle
+			self.Telemetry = e.telemetry
+			rep.Self = &self
+		} else if sleeping && sent[e.name] {
+			rep.Others = append(rep.Others, e.asleep)
+		} else {
+			rep.Others = append(rep.Others, e.vehicle)
+		}
+		if sent == nil {
+			continue
+		}
+		if sleeping {
+			sent[e.name] = true
+		} else {
+			delete(sent, e.name)
+		}
+	}
+	rep.Objects = f.objects
+	rep.Kinematics = f.kinematics
+	rep.TimeScale = f.timeScale
+	rep.Paused = f.paused
+}
+
+// inputQueue holds the latest input of each player until the next tick.
+type inputQueue struct {
+	mu      sync.Mutex
+	pending map[string]protocol.Input
+}
+
+func (q *inputQueue) push(in protocol.Input) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.pending == nil {
+		q.pending = map[string]protocol.Input{}
+	}
+	q.pending[in.Name] = in
+}
+
+func (q *inputQueue) drain() map[string]protocol.Input {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	pending := q.pending
+	q.pending = nil
+	return pending
+}
+
+// tick applies the queued inputs, advances the physics by step and
+// publishes the next frame. It runs on the physics goroutine only.
+func (w *World) tick(step time.Duration) {
+	inputs := w.inputs.drain()
+	for name, in := range inputs {
+		w.telemetry[name] = in.Telemetry
+	}
+	if len(inputs) > 0 && !w.ctx.Paused() {
+		w.ctx.IterVehicles(func(name string, v physics.Vehicle) {
+			if in, ok := inputs[name]; ok {
+				v.Set(&in)
+			}
+		})
+	}
+	w.ctx.Iter(step)
+	w.publish()
+}
+
+// publish builds the frame of the current physics state.
+func (w *World) publish() {
+	f := &frame{
+		timeScale: w.ctx.TimeScale(),
+		paused:    w.ctx.Paused(),
+	}
+	seen := map[string]bool{}
+	w.ctx.IterVehicles(func(name string, v physics.Vehicle) {
+		pv := &protocol.Vehicle{
+			Name:       name,
+			Kind:       v.Kind(),
+			Body:       v.Attitude(),
+			Tires:      v.Parts(),
+			Sleeping:   v.Sleeping(),
+			SignalLost: v.SignalLost(),
+		}
+		if pv.SignalLost != w.lost[name] {
+			if pv.SignalLost {
+				log.Println("failsafe:", name)
+			} else {
+				log.Println("signal:", name)
+			}
+			w.lost[name] = pv.SignalLost
+		}
+		e := entry{name: name, vehicle: pv, asleep: &protocol.Vehicle{Name: name, Sleeping: true}}
+		if w.telemetry[name] {
+			e.telemetry = v.Telemetry()
+		}
+		f.vehicles = append(f.vehicles, e)
+		seen[name] = true
+	})
+	for name := range w.telemetry {
+		if !seen[name] {
+			delete(w.telemetry, name)
+		}
+	}
+	for name := range w.lost {
+		if !seen[name] {
+			delete(w.lost, name)
+		}
+	}
+	w.ctx.IterObjects(func(o *protocol.Object) {
+		f.objects = append(f.objects, o)
+	})
+	w.ctx.IterKinematics(func(k *protocol.Kinematic) {
+		f.kinematics = append(f.kinematics, k)
+	})
+	w.frame.Store(f)
+}
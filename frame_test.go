@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nobonobo/rccargo/physics"
+	"github.com/nobonobo/rccargo/protocol"
+)
+
+func newTestWorld(t *testing.T, players ...string) *World {
+	ctx, err := physics.New("simple", protocol.DefaultProfile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := newWorld(ctx)
+	for _, name := range players {
+		if err := w.join(name, protocol.KindCar); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return w
+}
+
+func TestTelemetryOwnerOnly(t *testing.T) {
+	w := newTestWorld(t, "p1", "p2")
+	w.Update(&protocol.Input{Name: "p1", Telemetry: true}, &protocol.Output{})
+	w.tick(10 * time.Millisecond)
+	var own, other protocol.Output
+	w.Update(&protocol.Input{Name: "p1", Telemetry: true}, &own)
+	w.Update(&protocol.Input{Name: "p2"}, &other)
+	if own.Self == nil || own.Self.Telemetry == nil {
+		t.Fatalf("no telemetry for its owner: %+v", own.Self)
+	}
+	if len(other.Others) != 1 {
+		t.Fatalf("others: %d", len(other.Others))
+	}
+	for _, v := range other.Others {
+		if v.Telemetry != nil {
+			t.Errorf("telemetry of %s sent to another viewer", v.Name)
+		}
+	}
+}
+
+func TestViewers(t *testing.T) {
+	w := newTestWorld(t, "p1")
+	w.tick(10 * time.Millisecond)
+	for _, name := range []string{"p1", "stranger", "", "another"} {
+		var out protocol.Output
+		w.Update(&protocol.Input{Name: name}, &out)
+		n := len(out.Others)
+		if out.Self != nil {
+			n++
+		}
+		if n != 1 {
+			t.Fatalf("%q: world not returned: %+v", name, out)
+		}
+	}
+	if len(w.viewers) != 1 || w.viewers["p1"] == nil {
+		t.Fatalf("viewers: %v", w.viewers)
+	}
+	w.gc("p1")
+	if len(w.viewers) != 0 {
+		t.Fatalf("viewers after gc: %v", w.viewers)
+	}
+}
@@ -2,78 +2,122 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
+	"math"
 	"net"
 	"net/http"
 	"net/rpc"
 	"net/rpc/jsonrpc"
 	"os"
+	"regexp"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/net/websocket"
 
 	glm "github.com/Jragonmiris/mathgl"
-	"github.com/ianremmler/ode"
+	mgl "github.com/go-gl/mathgl/mgl64"
 
 	"github.com/nobonobo/rccargo/models"
+	"github.com/nobonobo/rccargo/physics"
+	_ "github.com/nobonobo/rccargo/physics/simple"
 	"github.com/nobonobo/rccargo/protocol"
 )
 
-var profile = protocol.Profile{
-	World: protocol.WorldProfile{
-		Gravity:                []float64{0, 0, -9.80665},
-		CFM:                    10e-5,
-		ERP:                    0.8,
-		QuickStepW:             1e-3,
-		QuickStepNumIterations: 10,
-		CollideNum:             2,
-		Mu:                     1e-6,
-		SoftCfm:                1e-6,
-		SoftErp:                0.3,
-	},
-	Vehicle: protocol.VehicleProfile{
-		BodyDensity:        0.05,
-		BodyBox:            []float64{0.200, 0.050, 0.380},
-		BodyZOffset:        0.0,
-		Wheelbase:          0.267,
-		Tread:              0.160,
-		TireDensity:        0.03,
-		TireDiameter:       0.088,
-		TireWidth:          0.033,
-		FudgeFactorJtParam: 0.01,
-		SuspensionStep:     1.0,
-		SuspensionSpring:   100,
-		SuspensionDamping:  0.1,
-	},
-}
+var backend = flag.String("physics", "", "physics backend: ode or simple (default ode when built with cgo)")
+
+// dynamicNode matches scene nodes simulated as loose objects: dyn_<kind>_*
+var dynamicNode = regexp.MustCompile(`^dyn_([a-z]+)_`)
+
+// standNode matches the scene node of the driver stand; it stays part of
+// the track as well.
+var standNode = regexp.MustCompile(`^driver_stand`)
+
+// startPosition is where vehicles join and reset to.
+var startPosition = []float64{-1.0, 1.0, 0.5}
 
 // World ...
 type World struct {
-	ctx    *models.Context
-	timers map[string]*time.Timer
+	ctx       physics.World
+	frame     atomic.Value // *frame
+	inputs    inputQueue
+	telemetry map[string]bool // players asking for telemetry, tick only
+	mu        sync.Mutex
+	timers    map[string]*time.Timer
+	viewers   map[string]*viewer
+	radios    map[string]*protocol.Transmitter
+	owners    map[string]*session // connection each player joined on
+	lost      map[string]bool     // vehicles in failsafe, tick only
+	// subscribers are the /push connections
+	subscribers subscribers
+}
+
+func newWorld(ctx physics.World) *World {
+	w := &World{
+		ctx:       ctx,
+		telemetry: map[string]bool{},
+		timers:    map[string]*time.Timer{},
+		viewers:   map[string]*viewer{},
+		radios:    map[string]*protocol.Transmitter{},
+		owners:    map[string]*session{},
+		lost:      map[string]bool{},
+	}
+	w.publish()
+	return w
 }
 
-// Join ...
+// Join joins with a car.
 func (w *World) Join(name string, rep *protocol.VehicleProfile) error {
+	if err := w.join(name, protocol.KindCar); err != nil {
+		return err
+	}
+	*rep = w.ctx.GetProfile().Vehicle
+	return nil
+}
+
+// JoinAs joins with a vehicle of the requested kind. The reply carries the
+// whole profile for drawing vehicles of every kind.
+func (w *World) JoinAs(req *protocol.Join, rep *protocol.Profile) error {
+	if err := w.join(req.Name, req.Kind); err != nil {
+		return err
+	}
+	*rep = w.ctx.GetProfile()
+	return nil
+}
+
+func (w *World) join(name, kind string) error {
 	if w.ctx.GetVehicle(name) != nil {
 		return fmt.Errorf("duplicated name: %s", name)
 	}
-	w.ctx.AddVehicle(name, []float64{-1.0, 1.0, 0.5})
+	if _, err := w.ctx.AddVehicle(name, kind, startPosition); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	w.timers[name] = time.AfterFunc(5*time.Second, func() {
 		w.gc(name)
 	})
-	*rep = profile.Vehicle
-	log.Println("join:", name)
+	tx := protocol.DefaultTransmitter()
+	w.radios[name] = &tx
+	w.viewers[name] = &viewer{asleep: map[string]bool{}}
+	log.Println("join:", name, kind)
 	return nil
 }
 
 func (w *World) gc(name string) {
 	w.ctx.RmVehicle(name)
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	if tm := w.timers[name]; tm != nil {
 		tm.Stop()
 	}
 	delete(w.timers, name)
+	delete(w.viewers, name)
+	delete(w.radios, name)
+	delete(w.owners, name)
 }
 
 // Bye ...
@@ -83,68 +127,217 @@ func (w *World) Bye(name string, rep *string) error {
 	return nil
 }
 
-// Update ...
+// Tune ...
+func (w *World) Tune(req *protocol.Tune, rep *protocol.VehicleProfile) error {
+	v := w.ctx.GetVehicle(req.Name)
+	if v == nil {
+		return fmt.Errorf("unknown name: %s", req.Name)
+	}
+	if v.Kind() != protocol.KindCar {
+		return fmt.Errorf("%s: a %s has no setup", req.Name, v.Kind())
+	}
+	setup := v.Profile()
+	setup.BodyBox = append([]float64(nil), setup.BodyBox...)
+	if err := json.Unmarshal(req.Setup, &setup); err != nil {
+		return err
+	}
+	profile := w.ctx.GetProfile()
+	if err := profile.Tune.Check(profile.Vehicle, setup); err != nil {
+		return err
+	}
+	w.ctx.SetVehicleProfile(req.Name, setup)
+	*rep = setup
+	log.Println("tune:", req.Name)
+	return nil
+}
+
+// GetSetup ...
+func (w *World) GetSetup(name string, rep *protocol.VehicleProfile) error {
+	v := w.ctx.GetVehicle(name)
+	if v == nil {
+		return fmt.Errorf("unknown name: %s", name)
+	}
+	if v.Kind() != protocol.KindCar {
+		return fmt.Errorf("%s: a %s has no setup", name, v.Kind())
+	}
+	*rep = v.Profile()
+	return nil
+}
+
+// Update queues the player's input for the next physics tick and returns
+// the world as of the last one.
 func (w *World) Update(req *protocol.Input, rep *protocol.Output) error {
-	w.ctx.IterVehicles(func(name string, v *models.Vehicle) {
-		ws := make([]protocol.Attitude, 4)
-		for i := 0; i < 4; i++ {
-			wheel := v.Wheel(i)
-			ws[i].Position = wheel.Position()
-			ws[i].Quaternion = wheel.Quaternion()
-		}
-		pv := &protocol.Vehicle{
-			Name:  name,
-			Body:  protocol.Attitude{Position: v.Position(), Quaternion: v.Quaternion()},
-			Tires: ws,
-		}
-		if req.Name == name {
-			(*rep).Self = pv
-			v.Set(req)
-		} else {
-			(*rep).Others = append((*rep).Others, pv)
-		}
-	})
+	w.receive(req)
+	f := w.frame.Load().(*frame)
+	if v := w.viewer(req.Name); v != nil {
+		v.output(req.Name, f, rep)
+	} else {
+		f.output(req.Name, nil, rep) // not joined: no bookkeeping
+	}
+	return nil
+}
+
+// receive queues the player's input for the next physics tick.
+func (w *World) receive(req *protocol.Input) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if tx := w.radios[req.Name]; tx != nil {
+		w.inputs.push(tx.Apply(*req))
+	}
 	if t := w.timers[req.Name]; t != nil {
 		t.Reset(5 * time.Second)
 	}
+}
+
+// viewer returns the sleep bookkeeping of the player name, nil when name
+// has not joined.
+func (w *World) viewer(name string) *viewer {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.viewers[name]
+}
+
+// GetTransmitter ...
+func (w *World) GetTransmitter(name string, rep *protocol.Transmitter) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	tx := w.radios[name]
+	if tx == nil {
+		return fmt.Errorf("unknown name: %s", name)
+	}
+	*rep = *tx
+	return nil
+}
+
+// SetTransmitter changes the fields given in req.Setup of the player's
+// input profile.
+func (w *World) SetTransmitter(req *protocol.TransmitterSetup, rep *protocol.Transmitter) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	tx := w.radios[req.Name]
+	if tx == nil {
+		return fmt.Errorf("unknown name: %s", req.Name)
+	}
+	setup := *tx
+	if err := json.Unmarshal(req.Setup, &setup); err != nil {
+		return err
+	}
+	if err := setup.Validate(); err != nil {
+		return err
+	}
+	*tx = setup
+	*rep = setup
+	log.Println("transmitter:", req.Name)
+	return nil
+}
+
+// Reset puts the player's vehicle back on the start position and repairs it.
+func (w *World) Reset(name string, rep *string) error {
+	if w.ctx.ResetVehicle(name, startPosition) == nil {
+		return fmt.Errorf("unknown name: %s", name)
+	}
+	log.Println("reset:", name)
 	return nil
 }
 
+// handshake accepts the binary subprotocol when the client offers it;
+// other clients talk JSON-RPC.
+func handshake(config *websocket.Config, req *http.Request) error {
+	var err error
+	config.Origin, err = websocket.Origin(config, req)
+	if err == nil && config.Origin == nil {
+		return fmt.Errorf("null origin")
+	}
+	offered := config.Protocol
+	config.Protocol = nil
+	for _, p := range offered {
+		if p == protocol.Subprotocol {
+			config.Protocol = []string{p}
+		}
+	}
+	return err
+}
+
 func (w *World) handle(ws *websocket.Conn) {
 	log.Println("connect:", ws.Request().RemoteAddr)
 	defer log.Println("disconnect:", ws.Request().RemoteAddr)
-	jsonrpc.ServeConn(ws)
+	s := rpc.NewServer()
+	s.RegisterName("World", newSession(w))
+	if p := ws.Config().Protocol; len(p) == 1 && p[0] == protocol.Subprotocol {
+		ws.PayloadType = websocket.BinaryFrame
+		s.ServeCodec(protocol.NewServerCodec(ws))
+		return
+	}
+	s.ServeCodec(jsonrpc.NewServerCodec(ws))
 }
 
-func callback(data interface{}, obj1, obj2 ode.Geom) {
-	ctx := data.(*models.Context)
-	body1, body2 := obj1.Body(), obj2.Body()
-	if body1 != 0 && body2 != 0 && body1.Connected(body2) {
-		return
+// addKinematic adds an animated scene node as a kinematic track element.
+// The mesh is scaled into body coordinates; the body follows the node
+// animation on the simulation clock.
+func addKinematic(ctx physics.World, model *models.Model, unit float64) error {
+	_, _, scale := model.Pose(0, unit)
+	var vertices []float64
+	var index []uint32
+	for _, g := range model.Geometry {
+		base := uint32(len(vertices) / 3)
+		vs := g.Triangles.VertexData
+		for i := 0; i+2 < len(vs); i += 3 {
+			vertices = append(vertices, vs[i]*scale[0]*unit, vs[i+1]*scale[1]*unit, vs[i+2]*scale[2]*unit)
+		}
+		for _, v := range g.Triangles.Index {
+			index = append(index, base+uint32(v))
+		}
 	}
-	cts := obj1.Collide(obj2, uint16(profile.World.CollideNum), 0)
-	for _, c := range cts {
-		contact := ode.NewContact()
-		contact.Surface.Mode = ode.Approx1CtParam
-		contact.Surface.Mode |= ode.SoftERPCtParam
-		contact.Surface.Mode |= ode.SoftCFMCtParam
-		contact.Surface.Mu = profile.World.Mu
-		contact.Surface.SoftCfm = profile.World.SoftCfm
-		contact.Surface.SoftErp = profile.World.SoftErp
-		contact.Geom = c
-		ct := ctx.World.NewContactJoint(
-			ctx.JointGroup, contact,
-		)
-		ct.Attach(body1, body2)
+	return ctx.AddKinematic(model.Name, vertices, index, func(t float64) protocol.Attitude {
+		pos, rot, _ := model.Pose(t, unit)
+		return protocol.Attitude{
+			Position:   []float64{pos[0], pos[1], pos[2]},
+			Quaternion: []float64{rot.W, rot.V[0], rot.V[1], rot.V[2]},
+		}
+	})
+}
+
+// fitNode returns the pose and size of the bounds of a scene node's
+// geometry in node coordinates, so a rotated node keeps its rotation.
+// With top the position is the center of the top face.
+func fitNode(model *models.Model, unit float64, top bool) (protocol.Attitude, []float64, error) {
+	pos, rot, scale := model.Pose(0, unit)
+	min, max := model.Bounds(glm.Scale3Dd(scale[0], scale[1], scale[2]), unit)
+	if math.IsInf(min[0], 1) {
+		return protocol.Attitude{}, nil, fmt.Errorf("%s: no geometry", model.Name)
+	}
+	q := mgl.Quat{W: rot.W, V: mgl.Vec3{rot.V[0], rot.V[1], rot.V[2]}}
+	center := mgl.Vec3{(min[0] + max[0]) / 2, (min[1] + max[1]) / 2, (min[2] + max[2]) / 2}
+	if top {
+		center[2] = max[2]
 	}
+	center = q.Rotate(center).Add(mgl.Vec3(pos))
+	body := protocol.Attitude{
+		Position:   []float64{center[0], center[1], center[2]},
+		Quaternion: []float64{rot.W, rot.V[0], rot.V[1], rot.V[2]},
+	}
+	size := []float64{max[0] - min[0], max[1] - min[1], max[2] - min[2]}
+	return body, size, nil
 }
 
-func main() {
-	fp, err := os.Open("./profile.json")
+// addPrimitive adds a scene node tagged with a collision shape as that
+// primitive, fitted to the bounds of its geometry in node coordinates.
+func addPrimitive(ctx physics.World, model *models.Model, unit float64) error {
+	body, size, err := fitNode(model, unit, model.Shape == models.ShapePlane)
 	if err != nil {
-		log.Fatalln(err)
+		return err
+	}
+	return ctx.AddPrimitive(model.Name, model.Shape, body, size)
+}
+
+func main() {
+	checkOnly := flag.Bool("check-profile", false, "print every problem in the profile and exit")
+	flag.Parse()
+	profile, err := loadProfile(*profileFile)
+	if *checkOnly {
+		os.Exit(printProfileErrors(err))
 	}
-	if err := json.NewDecoder(fp).Decode(&profile); err != nil {
+	if err != nil {
 		log.Fatalln(err)
 	}
 	b, err := json.MarshalIndent(profile, "", "  ")
@@ -159,19 +352,16 @@ func main() {
 		os.Exit(1)
 	}
 
-	ctx := models.NewContext(profile)
-	ctx.World.SetGravity(ode.V3(profile.World.Gravity...))
-	ctx.World.SetCFM(profile.World.CFM)
-	ctx.World.SetERP(profile.World.ERP)
-	ctx.World.SetQuickStepW(profile.World.QuickStepW)
-	ctx.World.SetQuickStepNumIterations(profile.World.QuickStepNumIterations)
-	//ctx.World.SetAutoDisable(true)
-	//ctx.World.SetContactMaxCorrectingVelocity(1.0)
-
-	world := &World{
-		ctx:    ctx,
-		timers: map[string]*time.Timer{},
+	if *backend == "" {
+		*backend = physics.Default()
+	}
+	ctx, err := physics.New(*backend, profile)
+	if err != nil {
+		log.Fatalln(err)
 	}
+	log.Println("physics:", *backend)
+
+	world := newWorld(ctx)
 
 	//world.ctx.Space.NewPlane(ode.V4(0, 1, 0, -0.5))
 
@@ -184,8 +374,40 @@ func main() {
 		for _, c := range model.Children {
 			matrix := c.Transform // c.WorldTransform()
 			fmt.Printf("%*schild: %s(%d) %#v\n", level*2, " ", c.Name, len(c.Geometry), matrix)
+			if m := dynamicNode.FindStringSubmatch(c.Name); m != nil {
+				body, size, err := fitNode(c, root.Unit, false)
+				if err == nil {
+					err = world.ctx.AddObject(c.Name, m[1], body, size)
+				}
+				if err != nil {
+					log.Println("object:", err)
+				} else {
+					continue
+				}
+			}
+			if c.Animation != nil {
+				if err := addKinematic(world.ctx, c, root.Unit); err != nil {
+					log.Println("kinematic:", err)
+				} else {
+					continue
+				}
+			}
+			if standNode.MatchString(c.Name) {
+				min, max := c.Bounds(matrix, root.Unit)
+				world.ctx.SetDriverStand([]float64{(min[0] + max[0]) / 2, (min[1] + max[1]) / 2, max[2] + physics.StandEye})
+			}
+			primitive := false
+			if c.Shape != "" {
+				if err := addPrimitive(world.ctx, c, root.Unit); err != nil {
+					log.Println("primitive:", err)
+				} else {
+					primitive = true
+				}
+			}
 			for _, g := range c.Geometry {
-				dat := ode.NewTriMeshData()
+				if primitive {
+					break
+				}
 				for i := 0; i < len(g.Triangles.VertexData); i += 3 {
 					v := glm.Vec4d{
 						g.Triangles.VertexData[i+0],
@@ -203,13 +425,7 @@ func main() {
 				for i, v := range g.Triangles.Index {
 					index[i] = uint32(v)
 				}
-				dat.Build(
-					ode.NewVertexList(len(g.Triangles.VertexData)/3, g.Triangles.VertexData...),
-					ode.NewTriVertexIndexList(len(index)/3, index...),
-				)
-				tm := world.ctx.Space.NewTriMesh(dat)
-
-				fmt.Println(tm.AABB())
+				world.ctx.AddTriMesh(g.Triangles.VertexData, index)
 			}
 			level++
 			f(c, level)
@@ -220,14 +436,20 @@ func main() {
 	go func() {
 		d := 10 * time.Millisecond
 		tick := time.NewTicker(d)
-		for {
+		every := pushEvery(d)
+		for n := 1; ; n++ {
 			<-tick.C
-			ctx.Iter(d, callback)
+			world.tick(d)
+			if every > 0 && n%every == 0 {
+				world.broadcast()
+			}
 		}
 	}()
 
-	rpc.Register(world)
-	http.Handle("/ws", websocket.Handler(world.handle))
+	go watchProfile(ctx, *profileFile, time.Second)
+
+	http.Handle("/ws", websocket.Server{Handler: world.handle, Handshake: handshake})
+	http.Handle("/push", websocket.Handler(world.handlePush))
 	http.Handle("/", http.FileServer(http.Dir("assets")))
 	log.Println("listen:", addr)
 	if err := http.Serve(l, nil); err != nil {
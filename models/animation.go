@@ -0,0 +1,168 @@
+package models
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/GlenKelley/go-collada"
+	glm "github.com/Jragonmiris/mathgl"
+)
+
+// Channel is one animated transform element of a node, addressed by its
+// sid, or one member of it (X, Y, Z or ANGLE), sampled at key times.
+// Keys interpolate linearly; BEZIER and STEP keys are read as linear.
+type Channel struct {
+	Sid    string
+	Member string    // "" for the whole element
+	Times  []float64 // s
+	Values []float64 // Stride values per key
+	Stride int
+}
+
+// Animation is the animated transform of a node. It loops over Duration.
+type Animation struct {
+	Channels []*Channel
+	Duration float64 // s
+	node     *collada.Node
+}
+
+// members are the indices of the addressable members of transform elements.
+var members = map[string]int{"X": 0, "Y": 1, "Z": 2, "ANGLE": 3}
+
+// sample returns the values of the channel at t.
+func (c *Channel) sample(t float64) []float64 {
+	key := func(i int) []float64 {
+		return c.Values[i*c.Stride : (i+1)*c.Stride]
+	}
+	i := sort.SearchFloat64s(c.Times, t)
+	switch {
+	case i == 0:
+		return key(0)
+	case i == len(c.Times):
+		return key(i - 1)
+	}
+	a, b := key(i-1), key(i)
+	f := (t - c.Times[i-1]) / (c.Times[i] - c.Times[i-1])
+	out := make([]float64, c.Stride)
+	for j := range out {
+		out[j] = a[j] + (b[j]-a[j])*f
+	}
+	return out
+}
+
+// Transform returns the node transform at t s into the animation.
+func (a *Animation) Transform(t float64) glm.Mat4d {
+	if a.Duration > 0 {
+		t = math.Mod(t, a.Duration)
+	}
+	return nodeTransform(a.node, func(sid string, v []float64) []float64 {
+		for _, c := range a.Channels {
+			if c.Sid != sid {
+				continue
+			}
+			s := c.sample(t)
+			if c.Member == "" {
+				if len(s) == len(v) {
+					v = s
+				}
+				continue
+			}
+			if i, ok := members[c.Member]; ok && i < len(v) && len(s) == 1 {
+				v = append([]float64(nil), v...)
+				v[i] = s[0]
+			}
+		}
+		return v
+	})
+}
+
+// splitTarget splits a channel target "node/sid.MEMBER" into its parts.
+func splitTarget(target string) (node collada.Id, sid, member string, ok bool) {
+	slash := strings.Index(target, "/")
+	if slash < 0 || strings.ContainsAny(target, "()") {
+		return "", "", "", false // array addressing is not supported
+	}
+	node, sid = collada.Id(target[:slash]), target[slash+1:]
+	if dot := strings.Index(sid, "."); dot >= 0 {
+		sid, member = sid[:dot], sid[dot+1:]
+	}
+	return node, sid, member, true
+}
+
+func (index *Index) indexAnimations() {
+	for _, lib := range index.Collada.LibraryAnimations {
+		for _, a := range lib.Animation {
+			index.indexAnimation(a)
+		}
+	}
+}
+
+func (index *Index) indexAnimation(a *collada.Animation) {
+	for _, child := range a.Animation {
+		index.indexAnimation(child)
+	}
+	for _, source := range a.Source {
+		if source.FloatArray != nil {
+			index.Data[source.Id] = source.FloatArray.F()
+		}
+	}
+	samplers := map[collada.Id]*collada.Sampler{}
+	for _, s := range a.Sampler {
+		samplers[s.Id] = s
+	}
+	for _, ch := range a.Channel {
+		id, _ := ch.Source.Id()
+		sampler := samplers[id]
+		nodeId, sid, member, ok := splitTarget(ch.Target)
+		if sampler == nil || !ok {
+			continue
+		}
+		node, ok := index.Id[nodeId].(*collada.Node)
+		if !ok {
+			continue
+		}
+		c := &Channel{Sid: sid, Member: member}
+		for _, input := range sampler.Input {
+			src, _ := input.Source.Id()
+			data, _ := index.Data[src].([]float64)
+			switch input.Semantic {
+			case "INPUT":
+				c.Times = data
+			case "OUTPUT":
+				c.Values = data
+			}
+		}
+		if len(c.Times) == 0 || len(c.Values)%len(c.Times) != 0 {
+			continue
+		}
+		c.Stride = len(c.Values) / len(c.Times)
+		anim := index.Animations[nodeId]
+		if anim == nil {
+			anim = &Animation{node: node}
+			index.Animations[nodeId] = anim
+		}
+		anim.Channels = append(anim.Channels, c)
+		anim.Duration = math.Max(anim.Duration, c.Times[len(c.Times)-1])
+	}
+}
+
+// Pose returns the position scaled by unit, rotation and scale of the model
+// transform at t s into its animation, or at rest when not animated.
+func (model *Model) Pose(t, unit float64) (pos glm.Vec3d, rot glm.Quatd, scale glm.Vec3d) {
+	m := model.Transform
+	if model.Animation != nil {
+		m = model.Animation.Transform(t)
+	}
+	r := RotationComponent(m)
+	for i := 0; i < 3; i++ {
+		scale[i] = math.Sqrt(r[i*3]*r[i*3] + r[i*3+1]*r[i*3+1] + r[i*3+2]*r[i*3+2])
+		if scale[i] > 0 {
+			for k := 0; k < 3; k++ {
+				r[i*3+k] /= scale[i]
+			}
+		}
+	}
+	pos = glm.Vec3d{m[12] * unit, m[13] * unit, m[14] * unit}
+	return pos, Quaternion(r), scale
+}
@@ -0,0 +1,89 @@
+//go:build cgo
+
+package models
+
+import (
+	"time"
+
+	"github.com/nobonobo/rccargo/physics"
+	"github.com/nobonobo/rccargo/protocol"
+)
+
+func init() {
+	physics.Register("ode", func(profile protocol.Profile) physics.World {
+		ctx := NewContext(profile)
+		ctx.ApplyProfile(profile)
+		return &backend{ctx}
+	})
+}
+
+// backend runs a Context as the "ode" physics.World.
+type backend struct {
+	*Context
+}
+
+// vehicle keeps a missing vehicle a nil interface.
+func vehicle(v Craft) physics.Vehicle {
+	if v == nil {
+		return nil
+	}
+	return v
+}
+
+func (b *backend) Iter(step time.Duration) {
+	b.Context.Iter(step, NearCallback)
+}
+
+func (b *backend) AddTriMesh(vertices []float64, index []uint32) {
+	b.Context.AddTriMesh(vertices, index)
+}
+
+func (b *backend) AddPrimitive(name, shape string, body protocol.Attitude, size []float64) error {
+	_, err := b.Context.AddPrimitive(name, shape, body, size)
+	return err
+}
+
+func (b *backend) AddObject(name, kind string, body protocol.Attitude, size []float64) error {
+	_, err := b.Context.AddObject(name, kind, body, size)
+	return err
+}
+
+func (b *backend) IterObjects(f func(*protocol.Object)) {
+	b.Context.IterObjects(func(o *Object) {
+		f(&protocol.Object{Name: o.Name, Shape: o.Shape, Size: o.Size, Body: o.Attitude()})
+	})
+}
+
+func (b *backend) AddKinematic(name string, vertices []float64, index []uint32, path physics.Path) error {
+	_, err := b.Context.AddKinematic(name, vertices, index, path)
+	return err
+}
+
+func (b *backend) IterKinematics(f func(*protocol.Kinematic)) {
+	b.Context.IterKinematics(func(k *Kinematic) {
+		f(&protocol.Kinematic{Name: k.Name, Body: k.Attitude()})
+	})
+}
+
+func (b *backend) AddVehicle(name, kind string, pos []float64) (physics.Vehicle, error) {
+	v, err := b.Context.AddCraft(name, kind, pos)
+	return vehicle(v), err
+}
+
+func (b *backend) GetVehicle(name string) physics.Vehicle {
+	return vehicle(b.Context.GetVehicle(name))
+}
+
+func (b *backend) ResetVehicle(name string, pos []float64) physics.Vehicle {
+	return vehicle(b.Context.ResetVehicle(name, pos))
+}
+
+func (b *backend) SetVehicleProfile(name string, profile protocol.VehicleProfile) physics.Vehicle {
+	return vehicle(b.Context.SetVehicleProfile(name, profile))
+}
+
+func (b *backend) IterVehicles(f func(string, physics.Vehicle)) {
+	b.Context.IterVehicles(func(name string, v Craft) {
+		f(name, v)
+	})
+}
@@ -0,0 +1,153 @@
+//go:build cgo
+
+package models
+
+import (
+	"math"
+	"sort"
+
+	"github.com/ianremmler/ode"
+
+	"github.com/nobonobo/rccargo/protocol"
+)
+
+type cellKey [2]int
+
+type cell struct {
+	passes int
+	rubber float64 // 0: green, 1: fully rubbered in
+	dust   float64 // 0: clean, 1: fully dusty
+	time   float64 // simulation time of the last update
+}
+
+// TrackCondition is a grid over the track floor. Cells rubber in and get
+// cleaned where wheels pass and collect dust where they don't.
+type TrackCondition struct {
+	profile protocol.TrackProfile
+	cells   map[cellKey]*cell
+	wetness float64 // 0: dry, 1: soaked
+	time    float64
+}
+
+// NewTrackCondition ...
+func NewTrackCondition(profile protocol.TrackProfile) *TrackCondition {
+	return &TrackCondition{
+		profile: profile,
+		cells:   map[cellKey]*cell{},
+		wetness: profile.Wetness,
+	}
+}
+
+func (t *TrackCondition) key(pos ode.Vector3) cellKey {
+	return cellKey{
+		int(math.Floor(pos[0] / t.profile.CellSize)),
+		int(math.Floor(pos[1] / t.profile.CellSize)),
+	}
+}
+
+// settle returns dust after dt more of settling.
+func (t *TrackCondition) settle(dust, dt float64) float64 {
+	return dust + (1-dust)*(1-math.Exp(-t.profile.DustRate*dt))
+}
+
+// cell returns the cell at k with dust settled up to now. Cells no wheel
+// has visited have been settling since time 0.
+func (t *TrackCondition) cell(k cellKey) *cell {
+	c := t.cells[k]
+	if c == nil {
+		c = &cell{dust: t.profile.Dust}
+		t.cells[k] = c
+	}
+	if dt := t.time - c.time; dt > 0 {
+		c.dust = t.settle(c.dust, dt)
+		c.time = t.time
+	}
+	return c
+}
+
+// pass records a wheel rolling into the cell at k.
+func (t *TrackCondition) pass(k cellKey) {
+	c := t.cell(k)
+	c.passes++
+	c.rubber += (1 - c.rubber) * t.profile.RubberRate
+	c.dust -= c.dust * t.profile.CleanRate
+}
+
+// advance moves the condition clock forward.
+func (t *TrackCondition) advance(dt float64) {
+	t.time += dt
+}
+
+// Grip returns the friction multiplier at pos.
+func (t *TrackCondition) Grip(pos ode.Vector3) float64 {
+	p := t.profile
+	wet := 1 - (1-p.WetGrip)*t.wetness
+	k := t.key(pos)
+	if _, ok := t.cells[k]; !ok {
+		return (1 - p.DustGrip*t.settle(p.Dust, t.time)) * wet
+	}
+	c := t.cell(k)
+	return (1 + p.RubberGrip*c.rubber) * (1 - p.DustGrip*c.dust) * wet
+}
+
+// Wetness ...
+func (t *TrackCondition) Wetness() float64 {
+	return t.wetness
+}
+
+// CellState ...
+type CellState struct {
+	X      int     `json:"x"`
+	Y      int     `json:"y"`
+	Passes int     `json:"passes"`
+	Rubber float64 `json:"rubber"`
+	Dust   float64 `json:"dust"`
+	Time   float64 `json:"time"`
+}
+
+// TrackState ...
+type TrackState struct {
+	Wetness float64     `json:"wetness"`
+	Time    float64     `json:"time"`
+	Cells   []CellState `json:"cells"`
+}
+
+func (t *TrackCondition) state() *TrackState {
+	s := &TrackState{Wetness: t.wetness, Time: t.time}
+	for k, c := range t.cells {
+		s.Cells = append(s.Cells, CellState{
+			X: k[0], Y: k[1],
+			Passes: c.passes, Rubber: c.rubber, Dust: c.dust, Time: c.time,
+		})
+	}
+	sort.Slice(s.Cells, func(i, j int) bool {
+		a, b := s.Cells[i], s.Cells[j]
+		return a.X < b.X || (a.X == b.X && a.Y < b.Y)
+	})
+	return s
+}
+
+func (t *TrackCondition) setState(s *TrackState) {
+	t.wetness = s.Wetness
+	t.time = s.Time
+	t.cells = map[cellKey]*cell{}
+	for _, c := range s.Cells {
+		t.cells[cellKey{c.X, c.Y}] = &cell{
+			passes: c.Passes, rubber: c.Rubber, dust: c.Dust, time: c.Time,
+		}
+	}
+}
+
+// SetWetness ...
+func (ctx *Context) SetWetness(wetness float64) {
+	ctx.Lock()
+	defer ctx.Unlock()
+	ctx.track.wetness = math.Max(0, math.Min(1, wetness))
+}
+
+// Wetness ...
+func (ctx *Context) Wetness() float64 {
+	ctx.RLock()
+	defer ctx.RUnlock()
+	return ctx.track.wetness
+}
@@ -0,0 +1,128 @@
+//go:build cgo
+
+package models
+
+import (
+	"math"
+
+	"github.com/ianremmler/ode"
+
+	"github.com/nobonobo/rccargo/protocol"
+)
+
+// NearCallback generates contact joints between colliding geoms.
+func NearCallback(data interface{}, obj1, obj2 ode.Geom) {
+	ctx := data.(*Context)
+	if obj1.IsSpace() || obj2.IsSpace() {
+		obj1.Collide2(obj2, data, NearCallback)
+		return
+	}
+	if obj1.CategoryBits()&obj2.CollideBits() == 0 && obj2.CategoryBits()&obj1.CollideBits() == 0 {
+		return // filtered by collision mode
+	}
+	// suspension rays of the raycast model only measure, they make no joints
+	if w, ok := obj1.Data().(*Wheel); ok {
+		w.rayHit(obj2)
+		return
+	}
+	if w, ok := obj2.Data().(*Wheel); ok {
+		w.rayHit(obj1)
+		return
+	}
+	body1, body2 := obj1.Body(), obj2.Body()
+	if body1 != 0 && body2 != 0 && body1.Connected(body2) {
+		return
+	}
+	// nothing to do between static and/or sleeping bodies
+	if (body1 == 0 || !body1.Enabled()) && (body2 == 0 || !body2.Enabled()) {
+		return
+	}
+	profile := ctx.Profile.World
+	cts := obj1.Collide(obj2, maxContacts(body1, body2, profile), 0)
+	if len(cts) > 0 && body1 != 0 && body2 != 0 {
+		// hit by a moving body: ode wakes the rest of the island through the joints
+		body1.SetEnabled(true)
+		body2.SetEnabled(true)
+	}
+	w1, _ := bodyData(body1).(*Wheel)
+	w2, _ := bodyData(body2).(*Wheel)
+	mu := profile.Mu
+	if w1 != nil {
+		mu *= w1.Grip()
+	}
+	if w2 != nil {
+		mu *= w2.Grip()
+	}
+	v1, v2 := vehicleOf(body1), vehicleOf(body2)
+	damage := ctx.Profile.Damage.Enabled && (v1 != nil || v2 != nil) && v1 != v2
+	for _, c := range cts {
+		grip := mu
+		// contact normals point into obj1
+		if w1 != nil {
+			w1.touch(c.Pos, c.Normal, c.Depth, body2)
+		}
+		if w2 != nil {
+			w2.touch(c.Pos, ode.V3(-c.Normal[0], -c.Normal[1], -c.Normal[2]), c.Depth, body1)
+		}
+		if (w1 != nil && body2 == 0) || (w2 != nil && body1 == 0) {
+			grip *= ctx.track.Grip(c.Pos)
+		}
+		contact := ode.NewContact()
+		contact.Surface.Mode = ode.Approx1CtParam
+		contact.Surface.Mode |= ode.SoftERPCtParam
+		contact.Surface.Mode |= ode.SoftCFMCtParam
+		contact.Surface.Mu = grip
+		contact.Surface.SoftCfm = profile.SoftCfm
+		contact.Surface.SoftErp = profile.SoftErp
+		contact.Geom = c
+		ct := ctx.World.NewContactJoint(
+			ctx.JointGroup, contact,
+		)
+		ct.Attach(body1, body2)
+		if damage && !rolling(w1, w2, body1, body2, c) {
+			ctx.impacts.watch(body1, body2, c.Pos, ct)
+		}
+	}
+}
+
+func bodyData(body ode.Body) interface{} {
+	if body == 0 {
+		return nil
+	}
+	return body.Data()
+}
+
+// rolling reports whether c is a wheel resting on the track from below,
+// which wears nothing. Its normal points into obj1.
+func rolling(w1, w2 *Wheel, body1, body2 ode.Body, c ode.ContactGeom) bool {
+	n := vec3(c.Normal)
+	var w *Wheel
+	switch {
+	case w1 != nil && body2 == 0:
+		w = w1
+	case w2 != nil && body1 == 0:
+		w, n = w2, n.Mul(-1)
+	default:
+		return false
+	}
+	up := vec3(w.vehicle.body.VectorToWorld(ode.V3(0, 0, 1)))
+	return n.Dot(up) > math.Sqrt2/2
+}
+
+// maxContacts caps the contacts generated for a pair of bodies.
+func maxContacts(body1, body2 ode.Body, profile protocol.WorldProfile) uint16 {
+	n := profile.CollideNum
+	for _, d := range []interface{}{bodyData(body1), bodyData(body2)} {
+		switch d.(type) {
+		case *Wheel:
+			if profile.WheelContacts > 0 && profile.WheelContacts < n {
+				n = profile.WheelContacts
+			}
+		case *Vehicle, *Quadcopter:
+			if profile.ChassisContacts > 0 && profile.ChassisContacts < n {
+				n = profile.ChassisContacts
+			}
+		}
+	}
+	return uint16(n)
+}
@@ -1,9 +1,15 @@
+//go:build cgo
+
 package models
 
 import (
+	"fmt"
+	"log"
+	"reflect"
 	"sync"
 	"time"
 
+	mgl "github.com/go-gl/mathgl/mgl64"
 	"github.com/ianremmler/ode"
 	"github.com/nobonobo/rccargo/protocol"
 )
@@ -16,51 +22,300 @@ func init() {
 type Context struct {
 	sync.RWMutex
 	ode.World
-	Space      ode.Space
+	Space      ode.Space // top level, holds Static and Dynamic
+	Static     ode.Space // track geometry, never collided with itself
+	Dynamic    ode.Space // vehicles and loose objects
 	JointGroup ode.JointGroup
 	Profile    protocol.Profile
-	vehicles   map[string]*Vehicle
+	vehicles   map[string]Craft
+	objects    []*Object
+	kinematics []*Kinematic
+	track      *TrackCondition
+	impacts    impacts
+	paused     bool
+	pending    int           // single steps requested while paused
+	timeScale  float64       // simulated seconds per real second
+	lag        time.Duration // scaled time not simulated yet
+	time       float64       // simulated seconds
+	statics    []ode.Geom    // static track geometry, for line of sight
+	stand      ode.Vector3   // driver stand antenna, nil: none
+	sight      ode.Ray       // stand to vehicle, in no space
 }
 
+// maxStepsPerIter bounds catch-up work when running faster than real time.
+const maxStepsPerIter = 8
+
 // NewContext ...
 func NewContext(profile protocol.Profile) *Context {
+	space := ode.NilSpace().NewSimpleSpace()
 	return &Context{
 		World:      ode.NewWorld(),
-		Space:      ode.NilSpace().NewHashSpace(),
-		JointGroup: ode.NewJointGroup(1000),
+		Space:      space,
+		Static:     newSpace(space, profile.World),
+		Dynamic:    newSpace(space, profile.World),
+		JointGroup: ode.NewJointGroup(0), // max_size is unused by ode, the group grows as needed
 		Profile:    profile,
-		vehicles:   map[string]*Vehicle{},
+		vehicles:   map[string]Craft{},
+		track:      NewTrackCondition(profile.Track),
+		timeScale:  1.0,
+		sight:      ode.NilSpace().NewRay(1),
+	}
+}
+
+// newSpace creates a collision space of the configured type in parent.
+// The type is fixed for the lifetime of the context.
+func newSpace(parent ode.Space, w protocol.WorldProfile) ode.Space {
+	switch w.SpaceType {
+	case "simple":
+		return parent.NewSimpleSpace()
+	case "sap":
+		return parent.NewSweepAndPruneSpace(ode.SAPAxesXYZ)
+	case "quadtree":
+		return parent.NewQuadTreeSpace(
+			ode.V3(w.QuadTreeCenter...), ode.V3(w.QuadTreeExtents...), w.QuadTreeDepth,
+		)
 	}
+	return parent.NewHashSpace()
 }
 
-// Iter ...
+// Iter advances the simulation by one real-time tick of length step.
+// The world is always integrated in fixed steps of that length; the time
+// scale decides how many of them a tick runs.
 func (ctx *Context) Iter(step time.Duration, callback ode.NearCallback) {
 	ctx.Lock()
 	defer ctx.Unlock()
+	if ctx.paused {
+		if ctx.pending > 0 {
+			ctx.pending--
+			ctx.step(step, callback)
+		}
+		return
+	}
+	ctx.lag += time.Duration(float64(step) * ctx.timeScale)
+	for n := 0; ctx.lag >= step; n++ {
+		if n == maxStepsPerIter {
+			ctx.lag = 0
+			break
+		}
+		ctx.lag -= step
+		ctx.step(step, callback)
+	}
+}
+
+func (ctx *Context) step(step time.Duration, callback ode.NearCallback) {
 	dt := float64(step) / float64(time.Second)
+	ctx.time += dt
+	ctx.track.advance(dt)
+	for _, k := range ctx.kinematics {
+		k.move(ctx.time-dt, dt)
+	}
 	for _, v := range ctx.vehicles {
+		receive(v, ctx.time)
 		v.Update(dt)
 	}
-	ctx.Space.Collide(ctx, callback)
+	ctx.updateFilters()
+	ctx.Space.Collide(ctx, callback)   // Static x Dynamic
+	ctx.Dynamic.Collide(ctx, callback) // Dynamic x Dynamic
+	for _, v := range ctx.vehicles {
+		v.react(dt)
+	}
 	ctx.World.QuickStep(dt)
+	ctx.impacts.count(dt, ctx.Profile.Damage)
 	ctx.JointGroup.Empty()
+	for _, v := range ctx.vehicles {
+		v.sense(ctx.time, dt)
+		ctx.tune(v)
+	}
+}
+
+// Pause ...
+func (ctx *Context) Pause() {
+	ctx.Lock()
+	defer ctx.Unlock()
+	ctx.paused = true
+	ctx.lag = 0
+}
+
+// Resume ...
+func (ctx *Context) Resume() {
+	ctx.Lock()
+	defer ctx.Unlock()
+	ctx.paused = false
+	ctx.pending = 0
+}
+
+// Paused ...
+func (ctx *Context) Paused() bool {
+	ctx.RLock()
+	defer ctx.RUnlock()
+	return ctx.paused
+}
+
+// StepOnce runs n fixed steps on the following ticks while paused.
+func (ctx *Context) StepOnce(n int) {
+	ctx.Lock()
+	defer ctx.Unlock()
+	if ctx.paused && n > 0 {
+		ctx.pending += n
+	}
+}
+
+// SetTimeScale sets the simulated seconds per real second, e.g. 0.25 for
+// slow motion.
+func (ctx *Context) SetTimeScale(scale float64) error {
+	if scale <= 0 || scale > maxStepsPerIter {
+		return fmt.Errorf("time scale %v out of range (0, %d]", scale, maxStepsPerIter)
+	}
+	ctx.Lock()
+	defer ctx.Unlock()
+	ctx.timeScale = scale
+	return nil
 }
 
-// AddVehicle ...
+// TimeScale ...
+func (ctx *Context) TimeScale() float64 {
+	ctx.RLock()
+	defer ctx.RUnlock()
+	return ctx.timeScale
+}
+
+// GetProfile ...
+func (ctx *Context) GetProfile() protocol.Profile {
+	ctx.RLock()
+	defer ctx.RUnlock()
+	return ctx.Profile
+}
+
+// ApplyProfile applies the world parameters to the running simulation and
+// rebuilds every vehicle with the new vehicle or quadcopter profile at its
+// current pose. Cars tuned by their players keep their setup while the new
+// tune limits allow it.
+func (ctx *Context) ApplyProfile(profile protocol.Profile) {
+	ctx.Lock()
+	defer ctx.Unlock()
+	prev, prevQuad := ctx.Profile.Vehicle, ctx.Profile.Quadcopter
+	ctx.Profile = profile
+	ctx.track.profile = profile.Track
+	w := profile.World
+	ctx.World.SetGravity(ode.V3(w.Gravity...))
+	ctx.World.SetCFM(w.CFM)
+	ctx.World.SetERP(w.ERP)
+	ctx.World.SetQuickStepW(w.QuickStepW)
+	ctx.World.SetQuickStepNumIterations(w.QuickStepNumIterations)
+	ctx.World.SetAutoDisable(w.AutoDisable)
+	ctx.World.SetAutoDisableLinearThreshold(w.AutoDisableLinearThreshold)
+	ctx.World.SetAutoDisableAngularThreshold(w.AutoDisableAngularThreshold)
+	ctx.World.SetAutoDisableSteps(w.AutoDisableSteps)
+	ctx.World.SetAutoDisableTime(w.AutoDisableTime)
+	for name, v := range ctx.vehicles {
+		switch v := v.(type) {
+		case *Vehicle:
+			v.sensors.SetProfile(profile.Sensors)
+			v.radio.SetProfile(profile.Radio, profile.Failsafe)
+			// vehicles tuned by their players keep their own setup while
+			// the new limits allow it
+			if setup := v.Profile(); reflect.DeepEqual(setup, prev) {
+				ctx.rebuildVehicle(name, profile.Vehicle)
+			} else if err := profile.Tune.Check(profile.Vehicle, setup); err != nil {
+				log.Println("setup reset:", name, err)
+				ctx.rebuildVehicle(name, profile.Vehicle)
+			}
+		case *Quadcopter:
+			v.sensors.SetProfile(profile.Sensors)
+			v.radio.SetProfile(profile.Radio, profile.Failsafe)
+			if !reflect.DeepEqual(profile.Quadcopter, prevQuad) {
+				s := v.State()
+				v.Destroy()
+				q := NewQuadcopter(ctx, profile.Quadcopter)
+				q.SetState(s)
+				q.sensors, q.radio = v.sensors, v.radio
+				ctx.vehicles[name] = q
+			}
+		}
+	}
+}
+
+// SetVehicleProfile rebuilds the named car in place with profile. Other
+// kinds are left as they are.
+func (ctx *Context) SetVehicleProfile(name string, profile protocol.VehicleProfile) Craft {
+	ctx.Lock()
+	defer ctx.Unlock()
+	return ctx.rebuildVehicle(name, profile)
+}
+
+// rebuildVehicle replaces the named car with one built from profile,
+// keeping pose, velocity and input. The caller must hold the lock.
+func (ctx *Context) rebuildVehicle(name string, profile protocol.VehicleProfile) Craft {
+	c := ctx.vehicles[name]
+	old, ok := c.(*Vehicle)
+	if !ok {
+		return c
+	}
+	s := old.State()
+	old.Destroy()
+	v := NewVehicle(ctx, profile)
+	v.SetPose(s.Body.Position, s.Body.Quaternion)
+	v.SetVelocity(s.Body.LinearVelocity, s.Body.AngularVelocity)
+	// keep the wheels spinning; after a change of wheel model they start
+	// at the chassis rate
+	for i, w := range v.wheels {
+		switch {
+		case w.ray != nil && i < len(s.Rays):
+			w.ray.spin, w.ray.omega = s.Rays[i].Spin, s.Rays[i].Omega
+		case w.ray == nil && i < len(s.Wheels):
+			w.body.SetAngularVelocity(s.Wheels[i].AngularVelocity)
+		}
+	}
+	v.setTires(s.Tires)
+	v.SetDamage(old.Damage())
+	v.team, v.ghostUntil = old.team, old.ghostUntil
+	v.sensors, v.radio = old.sensors, old.radio
+	v.apply(&s.Input)
+	ctx.vehicles[name] = v
+	return v
+}
+
+// AddVehicle adds a car.
 func (ctx *Context) AddVehicle(name string, pos []float64) *Vehicle {
+	v, _ := ctx.AddCraft(name, protocol.KindCar, pos)
+	return v.(*Vehicle)
+}
+
+// AddCraft adds a vehicle of kind, replacing any vehicle of the same name.
+func (ctx *Context) AddCraft(name, kind string, pos []float64) (Craft, error) {
 	ctx.Lock()
 	defer ctx.Unlock()
-	if v := ctx.vehicles[name]; v != nil {
-		v.Destroy()
+	v, err := ctx.newCraft(kind)
+	if err != nil {
+		return nil, err
+	}
+	if old := ctx.vehicles[name]; old != nil {
+		old.Destroy()
 	}
-	v := NewVehicle(ctx, ctx.Profile.Vehicle)
-	v.SetPosition(pos)
+	v.SetPose(pos, ode.Quaternion{1, 0, 0, 0})
+	ctx.ghost(v)
 	ctx.vehicles[name] = v
+	return v, nil
+}
+
+// ResetVehicle puts the named vehicle upright at pos, at rest and repaired.
+func (ctx *Context) ResetVehicle(name string, pos []float64) Craft {
+	ctx.Lock()
+	defer ctx.Unlock()
+	v := ctx.vehicles[name]
+	if v == nil {
+		return nil
+	}
+	v.SetPose(pos, ode.Quaternion{1, 0, 0, 0})
+	v.SetVelocity(ode.V3(0, 0, 0), ode.V3(0, 0, 0))
+	v.Repair()
+	v.Wake()
+	ctx.ghost(v)
 	return v
 }
 
 // GetVehicle ...
-func (ctx *Context) GetVehicle(name string) *Vehicle {
+func (ctx *Context) GetVehicle(name string) Craft {
 	ctx.RLock()
 	defer ctx.RUnlock()
 	return ctx.vehicles[name]
@@ -77,10 +332,89 @@ func (ctx *Context) RmVehicle(name string) {
 }
 
 // IterVehicles ...
-func (ctx *Context) IterVehicles(f func(string, *Vehicle)) {
+func (ctx *Context) IterVehicles(f func(string, Craft)) {
 	ctx.Lock()
 	defer ctx.Unlock()
 	for name, v := range ctx.vehicles {
 		f(name, v)
 	}
 }
+
+// AddTriMesh adds static track geometry from xyz vertex triples and
+// triangle vertex indices.
+func (ctx *Context) AddTriMesh(vertices []float64, index []uint32) ode.TriMesh {
+	ctx.Lock()
+	defer ctx.Unlock()
+	dat := ode.NewTriMeshData()
+	dat.Build(
+		ode.NewVertexList(len(vertices)/3, vertices...),
+		ode.NewTriVertexIndexList(len(index)/3, index...),
+	)
+	mesh := ctx.Static.NewTriMesh(dat)
+	ctx.statics = append(ctx.statics, mesh)
+	return mesh
+}
+
+// AddPrimitive adds static track geometry as an ODE primitive, see
+// physics.World.
+func (ctx *Context) AddPrimitive(name, shape string, body protocol.Attitude, size []float64) (ode.Geom, error) {
+	ctx.Lock()
+	defer ctx.Unlock()
+	var geom ode.Geom
+	switch shape {
+	case ShapeBox:
+		geom = ctx.Static.NewBox(ode.V3(size...))
+	case ShapeCylinder:
+		geom = ctx.Static.NewCylinder((size[0]+size[1])/4, size[2])
+	case ShapeSphere:
+		geom = ctx.Static.NewSphere((size[0] + size[1] + size[2]) / 6)
+	case ShapePlane:
+		n := quat(body).Rotate(mgl.Vec3{0, 0, 1})
+		p := mgl.Vec3{body.Position[0], body.Position[1], body.Position[2]}
+		plane := ctx.Static.NewPlane(ode.V4(n[0], n[1], n[2], n.Dot(p)))
+		ctx.statics = append(ctx.statics, plane)
+		return plane, nil
+	default:
+		return nil, fmt.Errorf("%s: unknown shape %q", name, shape)
+	}
+	geom.SetPosition(ode.V3(body.Position...))
+	geom.SetQuaternion(ode.Quaternion(body.Quaternion))
+	ctx.statics = append(ctx.statics, geom)
+	return geom, nil
+}
+
+// AddObject adds a dynamic track object of the given kind, with its
+// collision shape fitted to size, placed at body.
+func (ctx *Context) AddObject(name, kind string, body protocol.Attitude, size []float64) (*Object, error) {
+	ctx.Lock()
+	defer ctx.Unlock()
+	profile, ok := ctx.Profile.Objects[kind]
+	if !ok {
+		return nil, fmt.Errorf("%s: unknown object kind %q", name, kind)
+	}
+	o, err := NewObject(ctx, name, kind, body, size, profile)
+	if err != nil {
+		return nil, err
+	}
+	ctx.objects = append(ctx.objects, o)
+	return o, nil
+}
+
+// ResetObjects puts every dynamic object back in place.
+func (ctx *Context) ResetObjects() int {
+	ctx.Lock()
+	defer ctx.Unlock()
+	for _, o := range ctx.objects {
+		o.Reset()
+	}
+	return len(ctx.objects)
+}
+
+// IterObjects ...
+func (ctx *Context) IterObjects(f func(*Object)) {
+	ctx.RLock()
+	defer ctx.RUnlock()
+	for _, o := range ctx.objects {
+		f(o)
+	}
+}
@@ -0,0 +1,65 @@
+//go:build cgo
+
+package models
+
+import (
+	"fmt"
+
+	"github.com/ianremmler/ode"
+
+	"github.com/nobonobo/rccargo/physics"
+	"github.com/nobonobo/rccargo/protocol"
+)
+
+// Craft is a vehicle of any kind in a Context: a car (*Vehicle) or a
+// quadcopter (*Quadcopter). The methods beyond physics.Vehicle are called
+// with the context lock held.
+type Craft interface {
+	physics.Vehicle
+	Position() ode.Vector3
+	// Update applies the controls before the collision pass.
+	Update(dt float64)
+	// apply takes an input that came through the radio.
+	apply(in *protocol.Input)
+	receiver() *physics.Radio
+	// react applies forces from the contacts found by the collision pass.
+	react(dt float64)
+	// sense samples the sensors after the world step.
+	sense(now, dt float64)
+	SetPose(pos ode.Vector3, quat ode.Quaternion)
+	SetVelocity(linear, angular ode.Vector3)
+	Wake()
+	Repair()
+	State() *VehicleState
+	SetState(s *VehicleState)
+	Destroy()
+	geoms() []ode.Geom
+	filter() *filterState
+}
+
+// filterState is the collision filter state every kind of craft carries.
+type filterState struct {
+	team       int
+	ghostUntil float64 // simulation time
+}
+
+func (f *filterState) filter() *filterState {
+	return f
+}
+
+var (
+	_ Craft = (*Vehicle)(nil)
+	_ Craft = (*Quadcopter)(nil)
+)
+
+// newCraft builds a craft of kind with the current profile.
+// The caller must hold the lock.
+func (ctx *Context) newCraft(kind string) (Craft, error) {
+	switch kind {
+	case "", protocol.KindCar:
+		return NewVehicle(ctx, ctx.Profile.Vehicle), nil
+	case protocol.KindQuadcopter:
+		return NewQuadcopter(ctx, ctx.Profile.Quadcopter), nil
+	}
+	return nil, fmt.Errorf("unknown vehicle kind: %s", kind)
+}
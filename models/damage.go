@@ -0,0 +1,179 @@
+//go:build cgo
+
+package models
+
+import (
+	"math"
+
+	mgl "github.com/go-gl/mathgl/mgl64"
+	"github.com/ianremmler/ode"
+
+	"github.com/nobonobo/rccargo/protocol"
+)
+
+// vehicleOf returns the vehicle a chassis or wheel body belongs to.
+func vehicleOf(body ode.Body) *Vehicle {
+	switch d := bodyData(body).(type) {
+	case *Vehicle:
+		return d
+	case *Wheel:
+		return d.vehicle
+	}
+	return nil
+}
+
+// pair is two bodies in contact, ordered so that it names the pair
+// whichever order the collision callback saw them in.
+type pair struct {
+	body1, body2 ode.Body
+}
+
+func newPair(body1, body2 ode.Body) pair {
+	if body2 < body1 {
+		body1, body2 = body2, body1
+	}
+	return pair{body1, body2}
+}
+
+// impactJoint is a contact joint of a vehicle whose force is read back
+// after the step.
+type impactJoint struct {
+	pair
+	pos   ode.Vector3
+	joint ode.ContactJoint
+}
+
+// impacts turns the contact forces of vehicles into damage. An impact
+// lasts from the first touch of a pair of bodies until they separate and
+// counts once, with its hardest step; resting contacts never grow past
+// the impulse already counted.
+type impacts struct {
+	joints []impactJoint
+	peak   map[pair]float64 // hardest step impulse of each pair in contact, N*s
+}
+
+// watch asks ode for the force of ct, a contact joint of body1 and body2
+// at pos.
+func (im *impacts) watch(body1, body2 ode.Body, pos ode.Vector3, ct ode.ContactJoint) {
+	ct.SetFeedback(&ode.JointFeedback{})
+	im.joints = append(im.joints, impactJoint{pair: newPair(body1, body2), pos: pos, joint: ct})
+}
+
+// count damages the vehicles of the pairs whose impact grew in the step of
+// length dt. It runs after the step and before the contact joints are
+// destroyed.
+func (im *impacts) count(dt float64, profile protocol.DamageProfile) {
+	type step struct {
+		pair
+		force   mgl.Vec3 // on the first attached body
+		pos     ode.Vector3
+		hardest float64
+	}
+	var steps []*step
+	index := map[pair]*step{}
+	for _, c := range im.joints {
+		f := c.joint.Feedback()
+		if f == nil {
+			continue
+		}
+		force := vec3(f.Force1)
+		s := index[c.pair]
+		if s == nil {
+			s = &step{pair: c.pair}
+			index[c.pair] = s
+			steps = append(steps, s)
+		}
+		s.force = s.force.Add(force)
+		if l := force.Len(); l >= s.hardest {
+			s.hardest, s.pos = l, c.pos
+		}
+	}
+	im.joints = im.joints[:0]
+	peak := make(map[pair]float64, len(steps))
+	for _, s := range steps {
+		impulse := s.force.Len() * dt
+		counted := im.peak[s.pair]
+		if impulse > counted {
+			for _, v := range []*Vehicle{vehicleOf(s.body1), vehicleOf(s.body2)} {
+				if v != nil {
+					v.Hit(s.pos, counted, impulse, profile)
+				}
+			}
+			counted = impulse
+		}
+		peak[s.pair] = counted
+	}
+	im.peak = peak // pairs out of contact end their impact
+}
+
+// reset forgets the impacts in progress.
+func (im *impacts) reset() {
+	im.joints, im.peak = nil, nil
+}
+
+// Damage returns the accumulated damage of each component, 0: intact, 1: broken.
+func (v *Vehicle) Damage() protocol.Damage {
+	d := v.damage
+	d.Suspension = append([]float64(nil), v.damage.Suspension...)
+	return d
+}
+
+// SetDamage ...
+func (v *Vehicle) SetDamage(d protocol.Damage) {
+	v.damage = d
+	v.damage.Suspension = make([]float64, len(v.wheels))
+	copy(v.damage.Suspension, d.Suspension)
+	v.applyDamage()
+}
+
+// Repair ...
+func (v *Vehicle) Repair() {
+	v.SetDamage(protocol.Damage{})
+}
+
+// Hit accumulates damage from an impact at pos in world coordinates whose
+// hardest contact impulse (N*s) grew from counted to impulse. Impulses
+// below the threshold leave no mark.
+func (v *Vehicle) Hit(pos ode.Vector3, counted, impulse float64, profile protocol.DamageProfile) {
+	counted = math.Max(counted, profile.Threshold)
+	if impulse <= counted {
+		return
+	}
+	a := (impulse - counted) * profile.Scale
+	local := v.body.PosRelPoint(pos)
+	corner := 0
+	if local[1] < 0 {
+		corner += 2 // rear
+	} else {
+		v.damage.Steering = math.Min(1, v.damage.Steering+a/2)
+	}
+	if local[0] > 0 {
+		corner++ // right
+	}
+	v.damage.Suspension[corner] = math.Min(1, v.damage.Suspension[corner]+a)
+	v.damage.Motor = math.Min(1, v.damage.Motor+a/4)
+	v.applyDamage()
+}
+
+// applyDamage bends the kingpin axis of damaged corners and weakens the
+// steering servo. Motor damage is applied in Set, servo damage of ray
+// wheels in Update.
+func (v *Vehicle) applyDamage() {
+	for i, w := range v.wheels {
+		lr := 1.0
+		if i%2 == 0 {
+			lr = -1.0
+		}
+		bend := lr * v.damage.Suspension[i] * v.ctx.Profile.Damage.MaxBend
+		if w.ray != nil {
+			// no kingpin to bend: the corner toes out instead
+			w.ray.bend = mgl.DegToRad(bend)
+			continue
+		}
+		ax1 := mgl.HomogRotate3DY(mgl.DegToRad(bend)).Mul4(
+			mgl.HomogRotate3DX(mgl.DegToRad(v.profile.Camber)),
+		).Mul4x1(mgl.Vec4{0, 0, -1})
+		w.Joint.SetAxis1(v.body.VectorToWorld(ode.V3(ax1[0], ax1[1], ax1[2])))
+		w.Joint.SetParam(ode.FMaxJtParam, 1.0*(1-v.damage.Steering)) // 操舵トルク最大値Nm
+	}
+}
@@ -0,0 +1,77 @@
+//go:build cgo
+
+package models
+
+import (
+	"fmt"
+
+	"github.com/nobonobo/rccargo/physics"
+)
+
+// Collision categories of vehicle geoms. Everything else keeps the ode
+// default of all bits set and collides with everything.
+const (
+	catVehicle   = 1 << 2
+	catGhost     = 1 << 3
+	catTeam      = 1 << 4 // first team bit
+	MaxTeams     = physics.MaxTeams
+	vehicleBits  = (1<<(4+MaxTeams) - 1) &^ (catVehicle - 1)
+	allBits      = 1<<31 - 1 // fits a 32-bit int
+	ghostCollide = allBits &^ vehicleBits
+)
+
+// Collision modes of protocol.CollisionProfile.
+const (
+	CollideFull  = "full"  // cars hit each other
+	CollideGhost = "ghost" // cars pass through each other
+	CollideReset = "reset" // cars pass through each other for GhostTime after (re)spawning
+	CollideTeam  = "team"  // team mates pass through each other
+)
+
+// filterBits returns the category and collide bits for v at simulation time now.
+func (ctx *Context) filterBits(v *filterState) (int, int) {
+	switch ctx.Profile.Collision.Mode {
+	case CollideGhost:
+		return catVehicle, ghostCollide
+	case CollideReset:
+		if ctx.time < v.ghostUntil {
+			return catGhost, ghostCollide
+		}
+		return catVehicle, allBits &^ catGhost
+	case CollideTeam:
+		bit := catTeam << uint(v.team)
+		return bit, allBits &^ bit
+	}
+	return catVehicle, allBits
+}
+
+// updateFilters applies the collision mode to every vehicle's geoms.
+func (ctx *Context) updateFilters() {
+	for _, v := range ctx.vehicles {
+		cat, col := ctx.filterBits(v.filter())
+		for _, g := range v.geoms() {
+			g.SetCategoryBits(cat)
+			g.SetCollideBits(col)
+		}
+	}
+}
+
+// ghost lets v pass through other cars for the configured time.
+func (ctx *Context) ghost(v Craft) {
+	v.filter().ghostUntil = ctx.time + ctx.Profile.Collision.GhostTime
+}
+
+// SetTeam ...
+func (ctx *Context) SetTeam(name string, team int) error {
+	if team < 0 || team >= MaxTeams {
+		return fmt.Errorf("team %d out of range [0, %d)", team, MaxTeams)
+	}
+	ctx.Lock()
+	defer ctx.Unlock()
+	v := ctx.vehicles[name]
+	if v == nil {
+		return fmt.Errorf("unknown name: %s", name)
+	}
+	v.filter().team = team
+	return nil
+}
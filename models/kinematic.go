@@ -0,0 +1,90 @@
+//go:build cgo
+
+package models
+
+import (
+	"fmt"
+	"math"
+
+	mgl "github.com/go-gl/mathgl/mgl64"
+	"github.com/ianremmler/ode"
+
+	"github.com/nobonobo/rccargo/physics"
+	"github.com/nobonobo/rccargo/protocol"
+)
+
+// Kinematic is an animated track element (see-saw, turntable, gate): a
+// kinematic body with a triangle mesh, moved along its path every step.
+// It pushes vehicles and objects but nothing pushes it.
+type Kinematic struct {
+	Name string
+	body ode.Body
+	geom ode.TriMesh
+	path physics.Path
+}
+
+// AddKinematic adds an animated track element. The mesh collides like the
+// static track, so it goes in the Static space.
+func (ctx *Context) AddKinematic(name string, vertices []float64, index []uint32, path physics.Path) (*Kinematic, error) {
+	if len(index) < 3 {
+		return nil, fmt.Errorf("%s: no triangles", name)
+	}
+	ctx.Lock()
+	defer ctx.Unlock()
+	dat := ode.NewTriMeshData()
+	dat.Build(
+		ode.NewVertexList(len(vertices)/3, vertices...),
+		ode.NewTriVertexIndexList(len(index)/3, index...),
+	)
+	body := ctx.World.NewBody()
+	body.SetKinematic(true)
+	geom := ctx.Static.NewTriMesh(dat)
+	geom.SetBody(body)
+	k := &Kinematic{Name: name, body: body, geom: geom, path: path}
+	k.move(ctx.time, 0)
+	ctx.kinematics = append(ctx.kinematics, k)
+	return k, nil
+}
+
+func quat(a protocol.Attitude) mgl.Quat {
+	q := a.Quaternion
+	return mgl.Quat{W: q[0], V: mgl.Vec3{q[1], q[2], q[3]}}
+}
+
+// move puts k at its pose at now with the velocity that takes it to the
+// pose at now+dt, so contacts carry what stands on it.
+func (k *Kinematic) move(now, dt float64) {
+	a := k.path(now)
+	k.body.SetPosition(ode.V3(a.Position...))
+	k.body.SetQuaternion(ode.Quaternion(a.Quaternion))
+	k.body.SetEnabled(true)
+	if dt <= 0 {
+		return
+	}
+	b := k.path(now + dt)
+	linear := vec3(ode.V3(b.Position...)).Sub(vec3(ode.V3(a.Position...))).Mul(1 / dt)
+	d := quat(b).Mul(quat(a).Inverse())
+	if d.W < 0 {
+		d = d.Scale(-1)
+	}
+	angular := mgl.Vec3{}
+	if s := d.V.Len(); s > 1e-12 {
+		angular = d.V.Mul(2 * math.Atan2(s, d.W) / s / dt)
+	}
+	k.body.SetLinearVelocity(ode.V3(linear[0], linear[1], linear[2]))
+	k.body.SetAngularVelocity(ode.V3(angular[0], angular[1], angular[2]))
+}
+
+// Attitude ...
+func (k *Kinematic) Attitude() protocol.Attitude {
+	return protocol.Attitude{Position: k.body.Position(), Quaternion: k.body.Quaternion()}
+}
+
+// IterKinematics ...
+func (ctx *Context) IterKinematics(f func(*Kinematic)) {
+	ctx.RLock()
+	defer ctx.RUnlock()
+	for _, k := range ctx.kinematics {
+		f(k)
+	}
+}
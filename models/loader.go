@@ -15,6 +15,8 @@ type Model struct {
 	Children      []*Model
 	Parent        *Model
 	Unit          float64
+	Animation     *Animation // nil when static
+	Shape         string     // collision primitive the node is tagged with, "": trimesh
 }
 
 type Geometry struct {
@@ -30,6 +32,24 @@ func (model *Model) WorldTransform() glm.Mat4d {
 	return t
 }
 
+// Bounds returns the axis aligned bounds of the model's own geometry
+// transformed by matrix and scaled by unit.
+func (model *Model) Bounds(matrix glm.Mat4d, unit float64) (min, max glm.Vec3d) {
+	min = glm.Vec3d{math.Inf(1), math.Inf(1), math.Inf(1)}
+	max = glm.Vec3d{math.Inf(-1), math.Inf(-1), math.Inf(-1)}
+	for _, g := range model.Geometry {
+		vs := g.Triangles.VertexData
+		for i := 0; i+2 < len(vs); i += 3 {
+			pv := matrix.Mul4x1(glm.Vec4d{vs[i], vs[i+1], vs[i+2], 1.0}).Mul(unit)
+			for k := 0; k < 3; k++ {
+				min[k] = math.Min(min[k], pv[k])
+				max[k] = math.Max(max[k], pv[k])
+			}
+		}
+	}
+	return min, max
+}
+
 func NewSingleModel(name string, triangles *Triangles, transform glm.Mat4d) *Model {
 	geometries := []*Geometry{NewGeometry(name+"-mesh", triangles)}
 	model := NewModel(name, []*Model{}, geometries, transform)
@@ -45,6 +65,8 @@ func NewModel(name string, children []*Model, geometry []*Geometry, transform gl
 		children,
 		nil,
 		0.0,
+		nil,
+		"",
 	}
 	for _, child := range children {
 		child.Parent = model
@@ -61,6 +83,8 @@ func EmptyModel(name string) *Model {
 		[]*Model{},
 		nil,
 		0.0,
+		nil,
+		"",
 	}
 }
 
@@ -183,6 +207,8 @@ func LoadModel(index *Index, node *collada.Node, geometryTemplates map[collada.I
 		}
 	}
 	model := NewModel(node.Name, children, geoms, transform)
+	model.Animation = index.Animations[node.Id]
+	model.Shape = NodeShape(node)
 	return model, len(geoms) > 0 || len(children) > 0
 }
 
@@ -193,7 +219,7 @@ type Index struct {
 	Mesh        map[collada.Id]*Mesh
 	Transforms  map[collada.Id]glm.Mat4d
 	VisualScene *collada.VisualScene
-	// animations: Object
+	Animations  map[collada.Id]*Animation // by node
 	// cameras: Object
 	// controllers: Object
 	// effects: Object
@@ -224,6 +250,7 @@ func NewIndex(c *collada.Collada) (*Index, error) {
 		make(map[collada.Id]*Mesh),
 		make(map[collada.Id]glm.Mat4d),
 		nil,
+		make(map[collada.Id]*Animation),
 	}
 	index.init()
 	return index, nil
@@ -241,6 +268,7 @@ func (index *Index) AddId(id collada.Id, obj interface{}) {
 func (index *Index) init() {
 	index.indexVisualScenes()
 	index.indexGeometry()
+	index.indexAnimations()
 
 	ivs := index.Collada.Scene.InstanceVisualScene
 	if ivs != nil {
@@ -252,9 +280,17 @@ func (index *Index) init() {
 }
 
 func NodeTransform(node *collada.Node) glm.Mat4d {
+	return nodeTransform(node, func(sid string, v []float64) []float64 {
+		return v
+	})
+}
+
+// nodeTransform builds the node transform with the values of each element
+// passed through anim by sid.
+func nodeTransform(node *collada.Node, anim func(sid string, v []float64) []float64) glm.Mat4d {
 	transform := glm.Ident4d()
 	for _, matrix := range node.Matrix {
-		v := matrix.F()
+		v := anim(matrix.Sid, matrix.F())
 		transform = transform.Mul4(glm.Mat4d{
 			v[0], v[1], v[2], v[3],
 			v[4], v[5], v[6], v[7],
@@ -263,15 +299,15 @@ func NodeTransform(node *collada.Node) glm.Mat4d {
 		}.Transpose())
 	}
 	for _, translate := range node.Translate {
-		v := translate.F()
+		v := anim(translate.Sid, translate.F())
 		transform = transform.Mul4(glm.Translate3Dd(v[0], v[1], v[2]))
 	}
 	for _, rotation := range node.Rotate {
-		v := rotation.F()
+		v := anim(rotation.Sid, rotation.F())
 		transform = transform.Mul4(glm.HomogRotate3Dd(v[3]*math.Pi/180, glm.Vec3d{v[0], v[1], v[2]}))
 	}
 	for _, scale := range node.Scale {
-		v := scale.F()
+		v := anim(scale.Sid, scale.F())
 		transform = transform.Mul4(glm.Scale3Dd(v[0], v[1], v[2]))
 	}
 	return transform
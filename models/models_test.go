@@ -1,14 +1,46 @@
+//go:build cgo
+
 package models
 
 import (
+	"encoding/json"
+	"fmt"
+	"math"
 	"testing"
+	"time"
 
 	"github.com/ianremmler/ode"
 	"github.com/nobonobo/rccargo/protocol"
 )
 
+var testProfile = protocol.Profile{
+	World: protocol.DefaultProfile().World,
+	Track: protocol.DefaultProfile().Track,
+	Vehicle: protocol.VehicleProfile{
+		BodyDensity:        0.2,
+		BodyBox:            ode.V3(0.200, 0.350, 0.100),
+		BodyZOffset:        0.0,
+		Wheelbase:          0.267,
+		Tread:              0.160,
+		TireDensity:        0.1,
+		TireDiameter:       0.088,
+		TireWidth:          0.033,
+		FudgeFactorJtParam: 1.0,
+		SuspensionStep:     1e-4,
+		SuspensionSpring:   1.0e+4,
+		SuspensionDamping:  0.5,
+		Camber:             15.0,
+		FinalDrive:         1.0,
+		Compound:           protocol.DefaultProfile().Vehicle.Compound,
+	},
+}
+
 func callback(data interface{}, obj1, obj2 ode.Geom) {
 	ctx := data.(*Context)
+	if obj1.IsSpace() || obj2.IsSpace() {
+		obj1.Collide2(obj2, data, callback)
+		return
+	}
 	contact := ode.NewContact()
 	body1, body2 := obj1.Body(), obj2.Body()
 	if body1 != 0 && body2 != 0 && body1.Connected(body2) {
@@ -26,22 +58,328 @@ func callback(data interface{}, obj1, obj2 ode.Geom) {
 }
 
 func TestVehicle(t *testing.T) {
-	ctx := NewContext()
+	ctx := NewContext(testProfile)
 	ctx.World.SetGravity(ode.V3(0, 0, -0.5))
 
-	profile := protocol.Profile{
-		BodyDensity:  0.2,
-		BodyBox:      ode.V3(0.200, 0.100, 0.350),
-		BodyZOffset:  0.0,
-		Wheelbase:    0.267,
-		Tread:        0.160,
-		TireDensity:  0.1,
-		TireDiameter: 0.088,
-		TireWidth:    0.033,
-	}
-	v := NewVehicle(ctx, profile)
+	v := NewVehicle(ctx, testProfile.Vehicle)
 	t.Log(v)
 	for i := 0; i < 1000; i++ {
-		ctx.Iter(callback)
+		ctx.Iter(10*time.Millisecond, callback)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	profile := testProfile
+	profile.Sensors = protocol.DefaultProfile().Sensors
+	profile.Radio = protocol.DefaultProfile().Radio
+	profile.Radio.Range = 100
+	profile.Failsafe = protocol.DefaultProfile().Failsafe
+	ctx := NewContext(profile)
+	ctx.World.SetGravity(ode.V3(0, 0, -9.8))
+	ctx.Static.NewPlane(ode.V4(0, 0, 1, 0))
+	v := ctx.AddVehicle("test", []float64{0, 0, 0.1})
+	v.Set(&protocol.Input{Steering: 0.5, Accel: 1.0})
+	run := func(n int) ode.Vector3 {
+		for i := 0; i < n; i++ {
+			ctx.Iter(10*time.Millisecond, callback)
+		}
+		return ctx.GetVehicle("test").Position()
+	}
+	run(100)
+	// in flight when the snapshot is taken, then the failsafe again
+	v.Set(&protocol.Input{Steering: -0.5, Accel: 1.0})
+	v.Sensors()
+	b, err := json.Marshal(ctx.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := run(100)
+	lost := ctx.GetVehicle("test").SignalLost()
+	readings := ctx.GetVehicle("test").Sensors()
+	if !lost {
+		t.Fatal("failsafe not engaged")
+	}
+
+	snap := &Snapshot{}
+	if err := json.Unmarshal(b, snap); err != nil {
+		t.Fatal(err)
+	}
+	ctx.RmVehicle("test")
+	ctx.Restore(snap)
+	actual := run(100)
+	for i := range expected {
+		if expected[i] != actual[i] {
+			t.Fatalf("position mismatch after restore: %v != %v", actual, expected)
+		}
+	}
+	if ctx.GetVehicle("test").SignalLost() != lost {
+		t.Fatal("failsafe mismatch after restore")
+	}
+	got := ctx.GetVehicle("test").Sensors()
+	if len(got.IMU) != len(readings.IMU) || len(got.GPS) != len(readings.GPS) || len(got.GPS) == 0 {
+		t.Fatalf("readings after restore: %d imu %d gps, want %d %d", len(got.IMU), len(got.GPS), len(readings.IMU), len(readings.GPS))
+	}
+	for i, a := range got.IMU[0].Accel {
+		if a != readings.IMU[0].Accel[i] {
+			t.Fatalf("first imu sample after restore: %v != %v", got.IMU[0].Accel, readings.IMU[0].Accel)
+		}
+	}
+	for i, p := range got.GPS[0].Position {
+		if p != readings.GPS[0].Position[i] {
+			t.Fatalf("first gps fix after restore: %v != %v", got.GPS[0].Position, readings.GPS[0].Position)
+		}
+	}
+}
+
+func TestTelemetry(t *testing.T) {
+	ctx := NewContext(testProfile)
+	ctx.ApplyProfile(testProfile)
+	ctx.Static.NewPlane(ode.V4(0, 0, 1, 0))
+	ctx.AddVehicle("test", []float64{0, 0, 0.1})
+	for i := 0; i < 200; i++ {
+		ctx.Iter(10*time.Millisecond, NearCallback)
+	}
+	tm := ctx.GetVehicle("test").Telemetry()
+	if len(tm.Wheels) != 4 {
+		t.Fatalf("wheels: %d", len(tm.Wheels))
+	}
+	for i, w := range tm.Wheels {
+		if !w.Contact || w.Load <= 0 {
+			t.Errorf("wheel %d not loaded at rest: %+v", i, w)
+		}
+	}
+	s := ctx.GetVehicle("test").Sensors()
+	if len(s.IMU) == 0 || len(s.IMU[0].Encoders) != 4 {
+		t.Fatalf("no imu samples: %+v", s)
+	}
+}
+
+func TestRaycast(t *testing.T) {
+	profile := testProfile
+	profile.Vehicle.Model = ModelRaycast
+	profile.Vehicle.SuspensionTravel = 0.01
+	ctx := NewContext(profile)
+	ctx.ApplyProfile(profile)
+	ctx.Static.NewPlane(ode.V4(0, 0, 1, 0))
+	v := ctx.AddVehicle("test", []float64{0, 0, 0.1})
+	for i := 0; i < 200; i++ {
+		ctx.Iter(10*time.Millisecond, NearCallback)
+	}
+	for i, w := range v.Telemetry().Wheels {
+		if !w.Contact || w.Load <= 0 {
+			t.Errorf("wheel %d not loaded at rest: %+v", i, w)
+		}
+		if z := v.Wheel(i).Position()[2]; z < 0 || z > 0.1 {
+			t.Errorf("wheel %d at height %v", i, z)
+		}
+	}
+	start := v.Position()
+	v.Set(&protocol.Input{Accel: 1.0})
+	for i := 0; i < 100; i++ {
+		ctx.Iter(10*time.Millisecond, NearCallback)
+	}
+	if d := vec3(v.Position()).Sub(vec3(start)).Len(); d < 0.01 {
+		t.Fatalf("did not drive: moved %v", d)
+	}
+
+	// positive steering turns right like the hinge2 model
+	turn := func(model string) float64 {
+		p := profile
+		p.World.Mu = 0.75
+		p.Vehicle.Model = model
+		ctx := NewContext(p)
+		ctx.ApplyProfile(p)
+		ctx.Static.NewPlane(ode.V4(0, 0, 1, 0))
+		v := ctx.AddVehicle("test", []float64{0, 0, 0.1})
+		v.Set(&protocol.Input{Accel: 1.0, Steering: 1.0})
+		for i := 0; i < 200; i++ {
+			ctx.Iter(10*time.Millisecond, NearCallback)
+		}
+		return v.Position()[0]
+	}
+	if hinge2, raycast := turn(ModelHinge2), turn(ModelRaycast); hinge2 <= 0 || raycast <= 0 {
+		t.Fatalf("did not turn right: hinge2 x = %v, raycast x = %v", hinge2, raycast)
+	}
+}
+
+func TestQuadcopter(t *testing.T) {
+	profile := testProfile
+	profile.Quadcopter = protocol.DefaultProfile().Quadcopter
+	ctx := NewContext(profile)
+	ctx.ApplyProfile(profile)
+	ctx.Static.NewPlane(ode.V4(0, 0, 1, 0))
+	q, err := ctx.AddCraft("drone", protocol.KindQuadcopter, []float64{0, 0, 0.1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Set(&protocol.Input{Accel: 1.0})
+	for i := 0; i < 100; i++ {
+		ctx.Iter(10*time.Millisecond, NearCallback)
+	}
+	if z := q.Position()[2]; z < 0.5 {
+		t.Fatalf("did not climb: z = %v", z)
+	}
+	if len(q.Parts()) != 4 {
+		t.Fatalf("rotors: %d", len(q.Parts()))
+	}
+	s := ctx.Snapshot()
+	ctx.RmVehicle("drone")
+	ctx.Restore(s)
+	if v := ctx.GetVehicle("drone"); v == nil || v.Kind() != protocol.KindQuadcopter {
+		t.Fatalf("restored as %v", v)
+	}
+}
+
+func TestPause(t *testing.T) {
+	ctx := NewContext(testProfile)
+	ctx.ApplyProfile(testProfile)
+	v := ctx.AddVehicle("test", []float64{0, 0, 1.0})
+	ctx.Pause()
+	z := v.Position()[2]
+	for i := 0; i < 10; i++ {
+		ctx.Iter(10*time.Millisecond, NearCallback)
+	}
+	if v.Position()[2] != z {
+		t.Fatalf("moved while paused: %v != %v", v.Position()[2], z)
+	}
+	ctx.StepOnce(1)
+	for i := 0; i < 10; i++ {
+		ctx.Iter(10*time.Millisecond, NearCallback)
+	}
+	if v.Position()[2] >= z {
+		t.Fatalf("single step did not advance: %v", v.Position()[2])
+	}
+	if err := ctx.SetTimeScale(0); err == nil {
+		t.Fatal("zero time scale accepted")
+	}
+}
+
+func benchmarkStep(b *testing.B, cars int) {
+	ctx := NewContext(testProfile)
+	ctx.ApplyProfile(testProfile)
+	ctx.Static.NewPlane(ode.V4(0, 0, 1, 0))
+	for i := 0; i < cars; i++ {
+		pos := []float64{float64(i%8) * 0.4, float64(i/8) * 0.6, 0.1}
+		v := ctx.AddVehicle(fmt.Sprintf("car%d", i), pos)
+		v.Set(&protocol.Input{Steering: 0.2, Accel: 0.5})
+	}
+	for i := 0; i < 50; i++ {
+		ctx.Iter(10*time.Millisecond, NearCallback)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ctx.Iter(10*time.Millisecond, NearCallback)
+	}
+}
+
+func BenchmarkStep2(b *testing.B)  { benchmarkStep(b, 2) }
+func BenchmarkStep10(b *testing.B) { benchmarkStep(b, 10) }
+func BenchmarkStep40(b *testing.B) { benchmarkStep(b, 40) }
+
+func TestAnimation(t *testing.T) {
+	node, sid, member, ok := splitTarget("turntable/rotationZ.ANGLE")
+	if !ok || node != "turntable" || sid != "rotationZ" || member != "ANGLE" {
+		t.Fatalf("target: %q %q %q %v", node, sid, member, ok)
+	}
+	if _, _, _, ok := splitTarget("gate/transform(3)(0)"); ok {
+		t.Fatal("array addressing accepted")
+	}
+	c := &Channel{Times: []float64{0, 1, 2}, Values: []float64{0, 10, 30}, Stride: 1}
+	for _, s := range []struct{ t, want float64 }{{-1, 0}, {0.5, 5}, {1.5, 20}, {3, 30}} {
+		if v := c.sample(s.t)[0]; v != s.want {
+			t.Errorf("sample(%v) = %v, want %v", s.t, v, s.want)
+		}
+	}
+}
+
+func TestTrackCondition(t *testing.T) {
+	p := testProfile.Track
+	p.RubberRate, p.DustRate = 0, 1e-2
+	tc := NewTrackCondition(p)
+	driven := tc.key(ode.V3(0.1, 0.1, 0))
+	tc.pass(driven)
+	tc.advance(100)
+	g1, g2 := tc.Grip(ode.V3(0.1, 0.1, 0)), tc.Grip(ode.V3(10, 10, 0))
+	if g2 > g1 {
+		t.Fatalf("untouched cell has more grip than a driven one: %v > %v", g2, g1)
+	}
+	if want := 1 - p.DustGrip*tc.settle(p.Dust, 100); g2 != want {
+		t.Fatalf("untouched grip = %v, want %v", g2, want)
+	}
+}
+
+func TestDamage(t *testing.T) {
+	profile := testProfile
+	profile.Damage = protocol.DamageProfile{Enabled: true, Threshold: 1e-3, Scale: 100, MaxBend: 10}
+	intact := func(d protocol.Damage) bool {
+		for _, s := range d.Suspension {
+			if s != 0 {
+				return false
+			}
+		}
+		return d.Steering == 0 && d.Motor == 0
+	}
+
+	ctx := NewContext(profile)
+	ctx.ApplyProfile(profile)
+	ctx.Static.NewPlane(ode.V4(0, 0, 1, 0))
+	v := ctx.AddVehicle("test", []float64{0, 0, 0.1})
+	v.Set(&protocol.Input{Steering: 0.3, Accel: 1.0})
+	for i := 0; i < 300; i++ {
+		ctx.Iter(10*time.Millisecond, NearCallback)
+	}
+	if d := v.Damage(); !intact(d) {
+		t.Fatalf("damaged by driving on a plane: %+v", d)
+	}
+
+	ctx = NewContext(profile)
+	ctx.ApplyProfile(profile)
+	ctx.World.SetGravity(ode.V3(0, 0, 0))
+	wall := ctx.Static.NewBox(ode.V3(2, 0.1, 1))
+	wall.SetPosition(ode.V3(0, 1, 0))
+	v = ctx.AddVehicle("test", []float64{0, 0, 0})
+	v.SetVelocity(ode.V3(0, 3, 0), ode.V3(0, 0, 0))
+	for i := 0; i < 50; i++ {
+		ctx.Iter(10*time.Millisecond, NearCallback)
+	}
+	d := v.Damage()
+	if intact(d) {
+		t.Fatal("no damage from a wall strike")
+	}
+	if d.Suspension[0] == 0 && d.Suspension[1] == 0 {
+		t.Fatalf("front corners intact after a head-on strike: %+v", d)
+	}
+}
+
+func TestTireHeat(t *testing.T) {
+	c := protocol.DefaultProfile().Vehicle.Compound
+	const ambient, dt = 20.0, 0.01
+	w := &Wheel{ray: &rayWheel{load: 20, slide: 2}, ground: &groundContact{}, dt: dt, compound: c}
+	w.tire.Temperature = c.OptimalTemp
+	grip := w.Grip()
+	for i := 0; i < 300; i++ {
+		w.heat(dt, 1, ambient)
+	}
+	hot, wear := w.Temperature(), w.Wear()
+	if hot <= c.OptimalTemp || wear <= 0 {
+		t.Fatalf("sliding: temperature %v, wear %v", hot, wear)
+	}
+	if w.Grip() >= grip {
+		t.Fatalf("grip of a hot, worn tire %v, fresh %v", w.Grip(), grip)
+	}
+	w.ground = nil
+	prev := hot
+	for i := 0; i < 10000; i++ {
+		w.heat(dt, 1, ambient)
+		if w.Temperature() > prev {
+			t.Fatalf("warmed up while idle: %v > %v", w.Temperature(), prev)
+		}
+		prev = w.Temperature()
+	}
+	if math.Abs(w.Temperature()-ambient) > 1 {
+		t.Fatalf("idle tire at %v, ambient %v", w.Temperature(), ambient)
+	}
+	if w.Wear() != wear {
+		t.Fatalf("worn while idle: %v != %v", w.Wear(), wear)
 	}
 }
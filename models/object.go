@@ -0,0 +1,93 @@
+//go:build cgo
+
+package models
+
+import (
+	"fmt"
+
+	"github.com/ianremmler/ode"
+
+	"github.com/nobonobo/rccargo/protocol"
+)
+
+// Object is a loose piece of track furniture (cone, barrier, ball...)
+// simulated as a rigid body with a primitive collision shape.
+type Object struct {
+	Name  string
+	Kind  string
+	Shape string
+	Size  ode.Vector3 // box lengths or {diameter, diameter, length}
+	body  ode.Body
+	geom  ode.Geom
+	home  protocol.Attitude
+}
+
+// NewObject ...
+func NewObject(ctx *Context, name, kind string, home protocol.Attitude, size ode.Vector3, profile protocol.ObjectProfile) (*Object, error) {
+	body := ctx.World.NewBody()
+	mass := ode.NewMass()
+	var geom ode.Geom
+	switch profile.Shape {
+	case "box":
+		geom = ctx.Dynamic.NewBox(size)
+		mass.SetBox(profile.Density, size)
+	case "cylinder":
+		r := (size[0] + size[1]) / 4
+		size = ode.V3(2*r, 2*r, size[2])
+		geom = ctx.Dynamic.NewCylinder(r, size[2])
+		mass.SetCylinder(profile.Density, 3, r, size[2]) // 3: z-axis
+	case "sphere":
+		r := (size[0] + size[1] + size[2]) / 6
+		size = ode.V3(2*r, 2*r, 2*r)
+		geom = ctx.Dynamic.NewSphere(r)
+		mass.SetSphere(profile.Density, r)
+	default:
+		body.Destroy()
+		return nil, fmt.Errorf("%s: unknown shape %q", name, profile.Shape)
+	}
+	geom.SetBody(body)
+	body.SetMass(mass)
+	o := &Object{
+		Name:  name,
+		Kind:  kind,
+		Shape: profile.Shape,
+		Size:  size,
+		body:  body,
+		geom:  geom,
+		home:  home,
+	}
+	o.Reset()
+	return o, nil
+}
+
+// Reset puts the object back where the track placed it.
+func (o *Object) Reset() {
+	setBodyState(o.body, BodyState{
+		Position:        o.home.Position,
+		Quaternion:      o.home.Quaternion,
+		LinearVelocity:  ode.V3(0, 0, 0),
+		AngularVelocity: ode.V3(0, 0, 0),
+	})
+}
+
+func (o *Object) Destroy() {
+	o.geom.Destroy()
+	o.body.Destroy()
+}
+
+func (o *Object) Position() ode.Vector3 {
+	return o.body.Position()
+}
+
+func (o *Object) Quaternion() ode.Quaternion {
+	return o.body.Quaternion()
+}
+
+// Attitude ...
+func (o *Object) Attitude() protocol.Attitude {
+	return protocol.Attitude{Position: o.Position(), Quaternion: o.Quaternion()}
+}
+
+func (o *Object) Sleeping() bool {
+	return !o.body.Enabled()
+}
@@ -0,0 +1,208 @@
+//go:build cgo
+
+package models
+
+import (
+	mgl "github.com/go-gl/mathgl/mgl64"
+	"github.com/ianremmler/ode"
+
+	"github.com/nobonobo/rccargo/physics"
+	"github.com/nobonobo/rccargo/protocol"
+)
+
+// Quadcopter is an RC quadcopter: a box frame carried by the thrust of a
+// rotor at each corner of its top face. The rotors have no bodies; their
+// thrust and yaw reaction act on the frame.
+type Quadcopter struct {
+	filterState
+	ctx     *Context
+	profile protocol.QuadcopterProfile
+	body    ode.Body
+	geom    ode.Geom
+	in      protocol.Input
+	thrust  [4]float64 // N
+	spin    [4]float64 // rad, rotor angles for rendering
+	sensors *physics.Sensors
+	radio   *physics.Radio
+}
+
+// NewQuadcopter ...
+func NewQuadcopter(ctx *Context, profile protocol.QuadcopterProfile) *Quadcopter {
+	body := ctx.World.NewBody()
+	geom := ctx.Dynamic.NewBox(profile.FrameBox)
+	geom.SetBody(body)
+	mass := ode.NewMass()
+	mass.SetBox(profile.Density, profile.FrameBox)
+	body.SetMass(mass)
+	q := &Quadcopter{
+		ctx:     ctx,
+		profile: profile,
+		body:    body,
+		geom:    geom,
+		sensors: newSensors(ctx.Profile.Sensors),
+		radio:   newRadio(ctx.Profile),
+	}
+	body.SetData(q)
+	return q
+}
+
+// Kind ...
+func (q *Quadcopter) Kind() string {
+	return protocol.KindQuadcopter
+}
+
+func (q *Quadcopter) Destroy() {
+	q.geom.Destroy()
+	q.body.Destroy()
+}
+
+func (q *Quadcopter) Position() ode.Vector3 {
+	return q.body.Position()
+}
+
+// Attitude ...
+func (q *Quadcopter) Attitude() protocol.Attitude {
+	return protocol.Attitude{Position: q.body.Position(), Quaternion: q.body.Quaternion()}
+}
+
+// Parts returns the rotor attitudes, rotor axis along the frame z axis.
+func (q *Quadcopter) Parts() []protocol.Attitude {
+	frame := toQuat(q.body.Quaternion())
+	rs := make([]protocol.Attitude, len(q.thrust))
+	for i := range rs {
+		o := physics.RotorOffset(q.profile, i)
+		rs[i] = protocol.Attitude{
+			Position:   q.body.RelPointPos(ode.V3(o[0], o[1], o[2])),
+			Quaternion: fromQuat(frame.Mul(mgl.QuatRotate(q.spin[i], mgl.Vec3{0, 0, 1}))),
+		}
+	}
+	return rs
+}
+
+// Profile is zero: a quadcopter has no car setup.
+func (q *Quadcopter) Profile() protocol.VehicleProfile {
+	return protocol.VehicleProfile{}
+}
+
+// Input returns the last control input applied.
+func (q *Quadcopter) Input() protocol.Input {
+	return q.in
+}
+
+// Set sends in over the radio.
+func (q *Quadcopter) Set(in *protocol.Input) {
+	if in, ok := q.radio.Send(*in); ok {
+		q.apply(&in)
+	}
+}
+
+// apply takes in as the control input.
+func (q *Quadcopter) apply(in *protocol.Input) {
+	q.in = protocol.Input{
+		Steering: in.Steering,
+		Accel:    in.Accel,
+		Brake:    in.Brake,
+		Pitch:    in.Pitch,
+		Roll:     in.Roll,
+	}
+	if q.in != (protocol.Input{}) {
+		q.Wake()
+	}
+}
+
+// Sleeping reports whether the frame has been auto-disabled.
+func (q *Quadcopter) Sleeping() bool {
+	return !q.body.Enabled()
+}
+
+func (q *Quadcopter) Wake() {
+	q.body.SetEnabled(true)
+}
+
+// Repair does nothing, quadcopters take no damage.
+func (q *Quadcopter) Repair() {}
+
+// Update runs the flight controller and applies the rotor thrust.
+func (q *Quadcopter) Update(dt float64) {
+	if !q.body.Enabled() {
+		return
+	}
+	m := q.body.Mass().Mass
+	b := q.profile.FrameBox
+	up := q.body.VectorFromWorld(ode.V3(0, 0, 1))
+	omega := q.body.VectorFromWorld(q.body.AngularVelocity())
+	s := physics.FlightState{
+		Up:    [3]float64{up[0], up[1], up[2]},
+		Omega: [3]float64{omega[0], omega[1], omega[2]},
+		Climb: q.body.LinearVelocity()[2],
+		Mass:  m,
+		Inertia: [3]float64{
+			m * (b[1]*b[1] + b[2]*b[2]) / 12,
+			m * (b[0]*b[0] + b[2]*b[2]) / 12,
+			m * (b[0]*b[0] + b[1]*b[1]) / 12,
+		},
+		Gravity: -q.ctx.Profile.World.Gravity[2],
+	}
+	max := physics.MaxRotorThrust(q.profile, m, s.Gravity)
+	q.thrust = physics.RotorThrust(q.profile, q.in, s)
+	yaw := 0.0
+	for i, t := range q.thrust {
+		o := physics.RotorOffset(q.profile, i)
+		q.body.AddRelForceAtRelPos(ode.V3(0, 0, t), ode.V3(o[0], o[1], o[2]))
+		yaw += physics.RotorSpin[i] * q.profile.TorqueRatio * t
+		q.spin[i] += physics.RotorRate(i, t, max) * dt
+	}
+	q.body.AddRelTorque(ode.V3(0, 0, yaw))
+}
+
+func (q *Quadcopter) react(dt float64) {}
+
+// SetPose ...
+func (q *Quadcopter) SetPose(pos ode.Vector3, quat ode.Quaternion) {
+	q.body.SetPosition(pos)
+	q.body.SetQuaternion(quat)
+}
+
+// SetVelocity ...
+func (q *Quadcopter) SetVelocity(linear, angular ode.Vector3) {
+	q.body.SetLinearVelocity(linear)
+	q.body.SetAngularVelocity(angular)
+}
+
+// Telemetry ...
+func (q *Quadcopter) Telemetry() *protocol.Telemetry {
+	return &protocol.Telemetry{
+		LinearVelocity:  q.body.LinearVelocity(),
+		AngularVelocity: q.body.AngularVelocity(),
+		Wheels:          []protocol.WheelTelemetry{},
+		Rotors:          append([]float64(nil), q.thrust[:]...),
+		Signal:          q.radio.Signal(),
+	}
+}
+
+// State ...
+func (q *Quadcopter) State() *VehicleState {
+	radio, sensors := q.radio.State(), q.sensors.State()
+	return &VehicleState{
+		Kind:    protocol.KindQuadcopter,
+		Body:    getBodyState(q.body),
+		Input:   q.Input(),
+		Team:    q.team,
+		Ghost:   q.ghostUntil,
+		Radio:   &radio,
+		Sensors: &sensors,
+	}
+}
+
+// SetState ...
+func (q *Quadcopter) SetState(s *VehicleState) {
+	in := s.Input
+	q.apply(&in)
+	q.team, q.ghostUntil = s.Team, s.Ghost
+	setBodyState(q.body, s.Body)
+	setLink(q.radio, q.sensors, s)
+}
+
+func (q *Quadcopter) geoms() []ode.Geom {
+	return []ode.Geom{q.geom}
+}
@@ -0,0 +1,84 @@
+//go:build cgo
+
+package models
+
+import (
+	"math/rand"
+
+	"github.com/ianremmler/ode"
+
+	"github.com/nobonobo/rccargo/physics"
+	"github.com/nobonobo/rccargo/protocol"
+)
+
+func newRadio(profile protocol.Profile) *physics.Radio {
+	return physics.NewRadio(profile.Radio, profile.Failsafe, rand.Int63())
+}
+
+func (v *Vehicle) receiver() *physics.Radio {
+	return v.radio
+}
+
+func (q *Quadcopter) receiver() *physics.Radio {
+	return q.radio
+}
+
+// SignalLost reports whether the receiver holds the failsafe input.
+func (v *Vehicle) SignalLost() bool {
+	return v.radio.Lost()
+}
+
+// SignalLost ...
+func (q *Quadcopter) SignalLost() bool {
+	return q.radio.Lost()
+}
+
+// receive applies the input that reached the receiver of c by now.
+func receive(c Craft, now float64) {
+	if in, ok := c.receiver().Receive(now); ok {
+		c.apply(&in)
+	}
+}
+
+// SetDriverStand sets where the players stand and transmit from, nil for
+// a track without a driver stand.
+func (ctx *Context) SetDriverStand(pos []float64) {
+	ctx.Lock()
+	defer ctx.Unlock()
+	if pos == nil {
+		ctx.stand = nil
+		return
+	}
+	ctx.stand = ode.V3(pos...)
+}
+
+// inSight reports whether no track geometry lies between the driver stand
+// and pos. The caller must hold the lock.
+func (ctx *Context) inSight(pos ode.Vector3) bool {
+	d := vec3(pos).Sub(vec3(ctx.stand))
+	l := d.Len()
+	if l == 0 {
+		return true
+	}
+	d = d.Mul(1 / l)
+	ctx.sight.SetLength(l)
+	ctx.sight.SetPosDir(ctx.stand, ode.V3(d[0], d[1], d[2]))
+	for _, m := range ctx.statics {
+		if len(ctx.sight.Collide(m, 1, 0)) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// tune sets the signal of c from its distance to the driver stand and the
+// line of sight. The caller must hold the lock.
+func (ctx *Context) tune(c Craft) {
+	p := ctx.Profile.Radio
+	q := 1.0
+	if ctx.stand != nil && p.Range > 0 {
+		pos := c.Position()
+		q = physics.Signal(p, vec3(pos).Sub(vec3(ctx.stand)).Len(), ctx.inSight(pos))
+	}
+	c.receiver().SetSignal(q)
+}
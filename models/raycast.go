@@ -0,0 +1,200 @@
+//go:build cgo
+
+package models
+
+import (
+	"math"
+
+	mgl "github.com/go-gl/mathgl/mgl64"
+	"github.com/ianremmler/ode"
+
+	"github.com/nobonobo/rccargo/protocol"
+)
+
+// Vehicle models of protocol.VehicleProfile.Model.
+const (
+	ModelHinge2  = "hinge2"  // cylinder wheel bodies on hinge2 joints
+	ModelRaycast = "raycast" // suspension rays with analytic spring, damper and tire forces
+)
+
+// wheelRest is the rotation of a wheel relative to the chassis, the same
+// as the hinge2 wheel body: cylinder axis along the chassis x axis.
+var wheelRest = ode.Quaternion{0.5, -0.5, 0.5, -0.5}
+
+// rayWheel is the state of a wheel without a body. Its suspension ray
+// starts SuspensionTravel above the fully extended wheel center and points
+// down the chassis z axis to the bottom of the tire.
+type rayWheel struct {
+	geom    ode.Ray
+	length  float64
+	inertia float64 // kg*m^2 around the axle
+	travel  float64 // m, compression
+	steer   float64 // rad
+	bend    float64 // rad, toe of a damaged corner
+	spin    float64 // rad, for rendering
+	omega   float64 // rad/s, chassis relative to wheel like hinge2 Angle2Rate
+	vel     float64 // 動輪目標速度rad/s
+	fmax    float64 // 動輪トルク最大値Nm
+	load    float64 // N
+	ratio   float64
+	angle   float64 // rad
+	slide   float64 // m/s, sliding speed of the contact patch
+}
+
+// RayState ...
+type RayState struct {
+	Travel float64 `json:"travel"`
+	Steer  float64 `json:"steer"`
+	Spin   float64 `json:"spin"`
+	Omega  float64 `json:"omega"`
+	Load   float64 `json:"load"`
+	Slide  float64 `json:"slide"`
+}
+
+func (r *rayWheel) state() RayState {
+	return RayState{
+		Travel: r.travel,
+		Steer:  r.steer,
+		Spin:   r.spin,
+		Omega:  r.omega,
+		Load:   r.load,
+		Slide:  r.slide,
+	}
+}
+
+func (r *rayWheel) setState(s RayState) {
+	r.travel, r.steer, r.spin, r.omega = s.Travel, s.Steer, s.Spin, s.Omega
+	r.load, r.slide = s.Load, s.Slide
+}
+
+// newRayWheel ...
+func newRayWheel(ctx *Context, profile protocol.VehicleProfile) *Wheel {
+	radius := profile.TireDiameter / 2
+	mass := profile.TireDensity * math.Pi * radius * radius * profile.TireWidth
+	length := profile.SuspensionTravel + radius
+	ray := ctx.Dynamic.NewRay(length)
+	ray.SetParams(false, true)
+	ray.SetClosestHit(true)
+	w := &Wheel{geom: ray, radius: radius, rest: wheelRest, ray: &rayWheel{
+		geom:    ray,
+		length:  length,
+		inertia: mass * radius * radius / 2,
+	}}
+	ray.SetData(w)
+	return w
+}
+
+// springRates returns the spring (N/m) and damper (N*s/m) rates of the
+// suspension ERP and CFM the hinge2 model uses, so both models share a setup.
+func springRates(profile protocol.VehicleProfile, dt float64) (float64, float64) {
+	k := profile.SuspensionStep * profile.SuspensionSpring
+	base := k + profile.SuspensionDamping
+	erp, cfm := 1.0/base, k/base
+	return erp / (dt * cfm), (1 - erp) / cfm
+}
+
+// place moves the suspension ray along with the chassis.
+func (w *Wheel) place() {
+	b, o := w.vehicle.body, w.offset
+	top := b.RelPointPos(ode.V3(o[0], o[1], o[2]+w.vehicle.profile.SuspensionTravel))
+	w.ray.geom.SetPosDir(top, b.VectorToWorld(ode.V3(0, 0, -1)))
+}
+
+// rayHit records where the suspension ray of w meets other.
+func (w *Wheel) rayHit(other ode.Geom) {
+	if w.vehicle.Sleeping() || vehicleOf(other.Body()) == w.vehicle {
+		return
+	}
+	if o, ok := other.Data().(*Wheel); ok && o.ray != nil {
+		return
+	}
+	_, dir := w.ray.geom.PosDir()
+	for _, c := range w.ray.geom.Collide(other, 1, 0) {
+		n := c.Normal
+		if vec3(n).Dot(vec3(dir)) > 0 {
+			n = ode.V3(-n[0], -n[1], -n[2])
+		}
+		// depth of a ray contact is the distance from its origin
+		w.touch(c.Pos, n, w.ray.length-c.Depth, other.Body())
+	}
+}
+
+// axle returns the wheel axis in world coordinates. steer follows hinge2
+// Angle1, which measures the chassis against the wheel around -z.
+func (w *Wheel) axle() mgl.Vec3 {
+	s := w.ray.steer + w.ray.bend
+	return vec3(w.vehicle.body.VectorToWorld(ode.V3(math.Cos(s), math.Sin(s), 0)))
+}
+
+// suspend applies the spring, damper and tire forces of the ray wheels for
+// the contacts found by the last collision pass.
+func (v *Vehicle) suspend(dt float64) {
+	if v.profile.Model != ModelRaycast || v.Sleeping() {
+		return
+	}
+	kp, kd := springRates(v.profile, dt)
+	mc := v.body.Mass().Mass / float64(len(v.wheels)) // sprung mass per corner
+	up := vec3(v.body.VectorToWorld(ode.V3(0, 0, 1)))
+	world := v.ctx.Profile.World
+	for _, w := range v.wheels {
+		r := w.ray
+		tm := math.Max(-r.fmax, math.Min(r.fmax, (r.vel-r.omega)*r.inertia/dt))
+		r.omega += tm * dt / r.inertia
+		r.travel, r.load, r.ratio, r.angle, r.slide = 0, 0, 0, 0, 0
+		g := w.ground
+		if g == nil {
+			r.spin += r.omega * dt
+			continue
+		}
+		r.travel = g.depth
+		p := ode.V3(g.pos[0], g.pos[1], g.pos[2])
+		vp := vec3(v.body.PointVel(p))
+		if g.body != 0 {
+			vp = vp.Sub(vec3(g.body.PointVel(p)))
+		}
+		// implicit spring and damper: stable at any step size
+		xd := -vp.Dot(up)
+		f := math.Max(0, (kp*(r.travel+dt*xd)+kd*xd)/(1+(dt*kd+dt*dt*kp)/mc))
+		force := up.Mul(f)
+		fwd := g.normal.Cross(w.axle())
+		if fwd.Len() > 1e-9 {
+			fwd = fwd.Normalize()
+			side := fwd.Cross(g.normal)
+			mu := world.Mu * w.Grip()
+			if g.body == 0 {
+				mu *= v.ctx.track.Grip(p)
+			}
+			// forces that stop the patch sliding within one step, limited by friction
+			vx, vy := vp.Dot(fwd), vp.Dot(side)
+			s := vx - r.omega*w.radius
+			fx := -s / dt / (1/mc + w.radius*w.radius/r.inertia)
+			fy := -vy * mc / dt
+			if l, limit := math.Hypot(fx, fy), mu*f; l > limit {
+				fx, fy = fx*limit/l, fy*limit/l
+			}
+			r.omega -= fx * w.radius * dt / r.inertia
+			force = force.Add(fwd.Mul(fx)).Add(side.Mul(fy))
+			r.ratio = -s / math.Max(math.Abs(vx), 0.1)
+			r.angle = math.Atan2(vy, math.Abs(vx))
+			r.slide = math.Hypot(s, vy)
+		}
+		r.load = f
+		r.spin += r.omega * dt
+		v.body.AddForceAtPos(ode.V3(force[0], force[1], force[2]), p)
+		if g.body != 0 && g.body.Enabled() {
+			g.body.AddForceAtPos(ode.V3(-force[0], -force[1], -force[2]), p)
+		}
+	}
+}
+
+func (w *Wheel) rayPosition() ode.Vector3 {
+	o := w.offset
+	return w.vehicle.body.RelPointPos(ode.V3(o[0], o[1], o[2]+w.ray.travel))
+}
+
+func (w *Wheel) rayQuaternion() mgl.Quat {
+	return toQuat(w.vehicle.body.Quaternion()).
+		Mul(mgl.QuatRotate(w.ray.steer+w.ray.bend, mgl.Vec3{0, 0, 1})).
+		Mul(mgl.QuatRotate(-w.ray.spin, mgl.Vec3{1, 0, 0})).
+		Mul(toQuat(w.rest))
+}
@@ -0,0 +1,51 @@
+//go:build cgo
+
+package models
+
+import (
+	"math/rand"
+
+	"github.com/ianremmler/ode"
+
+	"github.com/nobonobo/rccargo/physics"
+	"github.com/nobonobo/rccargo/protocol"
+)
+
+func newSensors(profile protocol.SensorProfile) *physics.Sensors {
+	return physics.NewSensors(profile, rand.Int63())
+}
+
+// motion reads the state of body for the sensors.
+func motion(body ode.Body, now float64, wheels []float64) physics.Motion {
+	m := physics.Motion{Time: now, Wheels: wheels}
+	copy(m.Position[:], body.Position())
+	copy(m.Velocity[:], body.LinearVelocity())
+	copy(m.AngularVelocity[:], body.AngularVelocity())
+	copy(m.Quaternion[:], body.Quaternion())
+	copy(m.Gravity[:], body.World().Gravity())
+	return m
+}
+
+// sense feeds the motion of the last step to the sensors.
+func (v *Vehicle) sense(now, dt float64) {
+	wheels := make([]float64, len(v.wheels))
+	for i, w := range v.wheels {
+		wheels[i] = w.AngularVelocity()
+	}
+	v.sensors.Step(motion(v.body, now, wheels), dt)
+}
+
+// Sensors ...
+func (v *Vehicle) Sensors() *protocol.Sensors {
+	return v.sensors.Drain()
+}
+
+// sense feeds the motion of the last step to the sensors.
+func (q *Quadcopter) sense(now, dt float64) {
+	q.sensors.Step(motion(q.body, now, nil), dt)
+}
+
+// Sensors ...
+func (q *Quadcopter) Sensors() *protocol.Sensors {
+	return q.sensors.Drain()
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"encoding/xml"
+	"regexp"
+
+	"github.com/GlenKelley/go-collada"
+)
+
+// Collision primitives a track node can be tagged with.
+const (
+	ShapeBox      = "box"
+	ShapePlane    = "plane"
+	ShapeCylinder = "cylinder"
+	ShapeSphere   = "sphere"
+)
+
+// shapeSuffix matches node names tagged with a primitive, e.g. "wall_3.box"
+// or "kerb-cylinder.001" as duplicated by Blender.
+var shapeSuffix = regexp.MustCompile(`[._-](box|plane|cylinder|sphere)(\.[0-9]+)?$`)
+
+// ShapeProfile is the technique profile of the <extra> tag:
+//
+//	<extra><technique profile="rccargo"><shape>box</shape></technique></extra>
+const ShapeProfile = "rccargo"
+
+// NodeShape returns the collision primitive node is tagged with by name
+// suffix or <extra> property, "" for none.
+func NodeShape(node *collada.Node) string {
+	if m := shapeSuffix.FindStringSubmatch(node.Name); m != nil {
+		return m[1]
+	}
+	for _, extra := range node.Extra {
+		for _, t := range extra.Technique {
+			if t.Profile != ShapeProfile {
+				continue
+			}
+			var p struct {
+				Shape string `xml:"shape"`
+			}
+			if xml.Unmarshal([]byte("<technique>"+t.XML+"</technique>"), &p) != nil {
+				continue
+			}
+			switch p.Shape {
+			case ShapeBox, ShapePlane, ShapeCylinder, ShapeSphere:
+				return p.Shape
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,212 @@
+//go:build cgo
+
+package models
+
+/*
+#cgo LDFLAGS: -lode
+#include <ode/ode.h>
+*/
+import "C"
+import (
+	"log"
+
+	"github.com/ianremmler/ode"
+
+	"github.com/nobonobo/rccargo/physics"
+	"github.com/nobonobo/rccargo/protocol"
+)
+
+// BodyState ...
+type BodyState struct {
+	Position        []float64 `json:"position"`   // length=3
+	Quaternion      []float64 `json:"quaternion"` // length=4
+	LinearVelocity  []float64 `json:"linearVelocity"`
+	AngularVelocity []float64 `json:"angularVelocity"`
+	Disabled        bool      `json:"disabled,omitempty"`
+}
+
+func getBodyState(body ode.Body) BodyState {
+	return BodyState{
+		Position:        body.Position(),
+		Quaternion:      body.Quaternion(),
+		LinearVelocity:  body.LinearVelocity(),
+		AngularVelocity: body.AngularVelocity(),
+		Disabled:        !body.Enabled(),
+	}
+}
+
+func setBodyState(body ode.Body, s BodyState) {
+	body.SetPosition(s.Position)
+	body.SetQuaternion(s.Quaternion)
+	body.SetLinearVelocity(s.LinearVelocity)
+	body.SetAngularVelocity(s.AngularVelocity)
+	body.SetForce(ode.V3(0, 0, 0))
+	body.SetTorque(ode.V3(0, 0, 0))
+	body.SetEnabled(!s.Disabled)
+}
+
+// VehicleState ...
+type VehicleState struct {
+	Kind    string               `json:"kind,omitempty"` // empty: car
+	Body    BodyState            `json:"body"`
+	Wheels  []BodyState          `json:"wheels"`
+	Rays    []RayState           `json:"rays,omitempty"` // raycast model wheels
+	Tires   []TireState          `json:"tires,omitempty"`
+	Damage  *protocol.Damage     `json:"damage,omitempty"`
+	Input   protocol.Input       `json:"input"`
+	Team    int                  `json:"team,omitempty"`
+	Ghost   float64              `json:"ghost,omitempty"` // ghosted until simulation time
+	Radio   *physics.RadioState  `json:"radio,omitempty"`
+	Sensors *physics.SensorState `json:"sensors,omitempty"`
+}
+
+// Snapshot ...
+type Snapshot struct {
+	Seed     uint64                   `json:"seed"` // ode random seed(quickstep reorder)
+	Time     float64                  `json:"time"` // simulated seconds
+	Vehicles map[string]*VehicleState `json:"vehicles"`
+	Objects  map[string]BodyState     `json:"objects,omitempty"`
+	Track    *TrackState              `json:"track,omitempty"`
+}
+
+// State ...
+func (v *Vehicle) State() *VehicleState {
+	d := v.Damage()
+	radio, sensors := v.radio.State(), v.sensors.State()
+	s := &VehicleState{
+		Kind:    protocol.KindCar,
+		Body:    getBodyState(v.body),
+		Wheels:  make([]BodyState, 0, len(v.wheels)),
+		Damage:  &d,
+		Input:   v.Input(),
+		Team:    v.team,
+		Ghost:   v.ghostUntil,
+		Radio:   &radio,
+		Sensors: &sensors,
+	}
+	for _, w := range v.wheels {
+		if w.ray != nil {
+			s.Rays = append(s.Rays, w.ray.state())
+		} else {
+			s.Wheels = append(s.Wheels, getBodyState(w.body))
+		}
+		s.Tires = append(s.Tires, w.tire)
+	}
+	return s
+}
+
+// SetState ...
+func (v *Vehicle) SetState(s *VehicleState) {
+	in := s.Input
+	v.apply(&in)
+	v.team, v.ghostUntil = s.Team, s.Ghost
+	setBodyState(v.body, s.Body)
+	for i, w := range v.wheels {
+		switch {
+		case w.ray != nil && i < len(s.Rays):
+			w.ray.setState(s.Rays[i])
+		case w.ray == nil && i < len(s.Wheels):
+			setBodyState(w.body, s.Wheels[i])
+		}
+	}
+	v.setTires(s.Tires)
+	setLink(v.radio, v.sensors, s)
+	if s.Damage != nil {
+		v.SetDamage(*s.Damage)
+	} else {
+		v.Repair()
+	}
+}
+
+// setLink restores the receiver and sensors of a craft, kept as they are
+// by snapshots without them.
+func setLink(radio *physics.Radio, sensors *physics.Sensors, s *VehicleState) {
+	if s.Radio != nil {
+		radio.SetState(*s.Radio)
+	}
+	if s.Sensors != nil {
+		sensors.SetState(*s.Sensors)
+	}
+}
+
+// sameKind compares vehicle kinds, empty meaning a car.
+func sameKind(a, b string) bool {
+	if a == "" {
+		a = protocol.KindCar
+	}
+	if b == "" {
+		b = protocol.KindCar
+	}
+	return a == b
+}
+
+func (v *Vehicle) setTires(tires []TireState) {
+	for i, w := range v.wheels {
+		if i < len(tires) {
+			w.tire = tires[i]
+		}
+	}
+}
+
+// Snapshot ...
+func (ctx *Context) Snapshot() *Snapshot {
+	ctx.RLock()
+	defer ctx.RUnlock()
+	s := &Snapshot{
+		Seed:     uint64(C.dRandGetSeed()),
+		Vehicles: map[string]*VehicleState{},
+		Track:    ctx.track.state(),
+		Time:     ctx.time,
+	}
+	for name, v := range ctx.vehicles {
+		s.Vehicles[name] = v.State()
+	}
+	if len(ctx.objects) > 0 {
+		s.Objects = map[string]BodyState{}
+		for _, o := range ctx.objects {
+			s.Objects[o.Name] = getBodyState(o.body)
+		}
+	}
+	return s
+}
+
+// Restore ...
+func (ctx *Context) Restore(s *Snapshot) {
+	ctx.Lock()
+	defer ctx.Unlock()
+	for name, v := range ctx.vehicles {
+		if s.Vehicles[name] == nil {
+			v.Destroy()
+			delete(ctx.vehicles, name)
+		}
+	}
+	for name, state := range s.Vehicles {
+		v := ctx.vehicles[name]
+		if v != nil && !sameKind(v.Kind(), state.Kind) {
+			v.Destroy()
+			v = nil
+		}
+		if v == nil {
+			var err error
+			if v, err = ctx.newCraft(state.Kind); err != nil {
+				log.Println("restore:", name, err)
+				delete(ctx.vehicles, name)
+				continue
+			}
+			ctx.vehicles[name] = v
+		}
+		v.SetState(state)
+	}
+	for _, o := range ctx.objects {
+		if state, ok := s.Objects[o.Name]; ok {
+			setBodyState(o.body, state)
+		}
+	}
+	if s.Track != nil {
+		ctx.track.setState(s.Track)
+	}
+	ctx.time = s.Time
+	ctx.JointGroup.Empty()
+	ctx.impacts.reset()
+	C.dRandSetSeed(C.ulong(s.Seed))
+}
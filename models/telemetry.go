@@ -0,0 +1,139 @@
+//go:build cgo
+
+package models
+
+import (
+	"math"
+
+	mgl "github.com/go-gl/mathgl/mgl64"
+	"github.com/ianremmler/ode"
+
+	"github.com/nobonobo/rccargo/protocol"
+)
+
+type groundContact struct {
+	pos    mgl.Vec3
+	normal mgl.Vec3 // pointing into the wheel
+	depth  float64
+	body   ode.Body // the other body, 0 for static geometry
+}
+
+func vec3(v ode.Vector3) mgl.Vec3 {
+	return mgl.Vec3{v[0], v[1], v[2]}
+}
+
+func (w *Wheel) touch(pos, normal ode.Vector3, depth float64, body ode.Body) {
+	if w.ground == nil || depth > w.ground.depth {
+		w.ground = &groundContact{pos: vec3(pos), normal: vec3(normal), depth: depth, body: body}
+	}
+}
+
+// InContact reports whether the wheel touched anything in the last step.
+func (w *Wheel) InContact() bool {
+	return w.ground != nil
+}
+
+// AngularVelocity returns the spin rate around the axle in rad/s.
+func (w *Wheel) AngularVelocity() float64 {
+	if w.ray != nil {
+		return w.ray.omega
+	}
+	return w.Joint.Angle2Rate()
+}
+
+// SuspensionTravel returns the compression of the suspension in m.
+func (w *Wheel) SuspensionTravel() float64 {
+	if w.ray != nil {
+		return w.ray.travel
+	}
+	d := vec3(w.Joint.Anchor2()).Sub(vec3(w.Joint.Anchor()))
+	return -d.Dot(vec3(w.Joint.Axis1()))
+}
+
+// Load estimates the normal load in N from the suspension spring rate
+// (ERP/(h*CFM)) and the wheel weight.
+func (w *Wheel) Load() float64 {
+	if w.ground == nil || w.dt == 0 {
+		return 0
+	}
+	if w.ray != nil {
+		return w.ray.load
+	}
+	erp := w.Joint.Param(ode.SuspensionERPJtParam)
+	cfm := w.Joint.Param(ode.SuspensionCFMJtParam)
+	if cfm == 0 {
+		return 0
+	}
+	g := vec3(w.body.World().Gravity()).Len()
+	return math.Max(0, erp/(w.dt*cfm)*w.SuspensionTravel()+w.body.Mass().Mass*g)
+}
+
+// slip returns the longitudinal slip ratio and the slip angle in rad.
+func (w *Wheel) slip() (float64, float64) {
+	if w.ground == nil {
+		return 0, 0
+	}
+	if w.ray != nil {
+		return w.ray.ratio, w.ray.angle
+	}
+	n := w.ground.normal
+	axle := vec3(w.Joint.Axis2())
+	fwd := n.Cross(axle)
+	if fwd.Len() < 1e-9 {
+		return 0, 0
+	}
+	fwd = fwd.Normalize()
+	side := fwd.Cross(n)
+	v := vec3(w.body.LinearVelocity())
+	p := vec3(w.body.PointVel(ode.V3(w.ground.pos[0], w.ground.pos[1], w.ground.pos[2])))
+	vx, vy := v.Dot(fwd), v.Dot(side)
+	den := math.Max(math.Abs(vx), 0.1)
+	return -p.Dot(fwd) / den, math.Atan2(vy, math.Abs(vx))
+}
+
+// SlipRatio ...
+func (w *Wheel) SlipRatio() float64 {
+	ratio, _ := w.slip()
+	return ratio
+}
+
+// SlipAngle ...
+func (w *Wheel) SlipAngle() float64 {
+	_, angle := w.slip()
+	return angle
+}
+
+// LinearVelocity ...
+func (v *Vehicle) LinearVelocity() ode.Vector3 {
+	return v.body.LinearVelocity()
+}
+
+// AngularVelocity ...
+func (v *Vehicle) AngularVelocity() ode.Vector3 {
+	return v.body.AngularVelocity()
+}
+
+// Telemetry ...
+func (v *Vehicle) Telemetry() *protocol.Telemetry {
+	t := &protocol.Telemetry{
+		LinearVelocity:  v.LinearVelocity(),
+		AngularVelocity: v.AngularVelocity(),
+		Wheels:          make([]protocol.WheelTelemetry, len(v.wheels)),
+		Damage:          v.Damage(),
+		Signal:          v.radio.Signal(),
+	}
+	for i, w := range v.wheels {
+		ratio, angle := w.slip()
+		t.Wheels[i] = protocol.WheelTelemetry{
+			Contact:          w.InContact(),
+			SlipRatio:        ratio,
+			SlipAngle:        angle,
+			Load:             w.Load(),
+			SuspensionTravel: w.SuspensionTravel(),
+			AngularVelocity:  w.AngularVelocity(),
+			Temperature:      w.Temperature(),
+			Wear:             w.Wear(),
+		}
+	}
+	return t
+}
@@ -0,0 +1,59 @@
+//go:build cgo
+
+package models
+
+import (
+	"math"
+
+	"github.com/ianremmler/ode"
+)
+
+// TireState ...
+type TireState struct {
+	Temperature float64 `json:"temperature"`
+	Wear        float64 `json:"wear"`
+	Cell        cellKey `json:"cell"`              // last track condition cell rolled over
+	OnTrack     bool    `json:"onTrack,omitempty"` // Cell is set
+}
+
+// Temperature returns the tire temperature in degC.
+func (w *Wheel) Temperature() float64 {
+	return w.tire.Temperature
+}
+
+// Wear returns 0 for a new tire up to 1 for a worn out one.
+func (w *Wheel) Wear() float64 {
+	return w.tire.Wear
+}
+
+// Grip returns the friction multiplier of the compound at the current
+// temperature and wear.
+func (w *Wheel) Grip() float64 {
+	c := w.compound
+	d := (w.tire.Temperature - c.OptimalTemp) / c.TempWindow
+	temp := 1 - 0.3*math.Min(1, d*d)
+	wear := 1 - w.tire.Wear*(1-c.WornGrip)
+	return c.Grip * temp * wear
+}
+
+// heat turns the slip energy of the last step into temperature and wear,
+// and cools the tire toward ambient.
+func (w *Wheel) heat(dt, mu, ambient float64) {
+	c := w.compound
+	if w.ground != nil {
+		e := mu * w.Grip() * w.Load() * w.slideSpeed() * dt
+		w.tire.Temperature += e * c.HeatRate
+		w.tire.Wear = math.Min(1, w.tire.Wear+e*c.WearRate)
+	}
+	w.tire.Temperature -= (w.tire.Temperature - ambient) * math.Min(1, c.CoolRate*dt)
+}
+
+// slideSpeed returns the sliding speed of the contact patch in m/s.
+func (w *Wheel) slideSpeed() float64 {
+	if w.ray != nil {
+		return w.ray.slide
+	}
+	g := w.ground
+	p := vec3(w.body.PointVel(ode.V3(g.pos[0], g.pos[1], g.pos[2])))
+	return p.Sub(g.normal.Mul(p.Dot(g.normal))).Len()
+}
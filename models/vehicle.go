@@ -1,3 +1,5 @@
+//go:build cgo
+
 package models
 
 /*
@@ -10,14 +12,24 @@ import (
 	mgl "github.com/go-gl/mathgl/mgl64"
 	"github.com/ianremmler/ode"
 
+	"github.com/nobonobo/rccargo/physics"
 	"github.com/nobonobo/rccargo/protocol"
 )
 
 // Wheel ...
 type Wheel struct {
-	Joint ode.Hinge2Joint
-	body  ode.Body
-	geom  ode.Geom
+	Joint    ode.Hinge2Joint
+	body     ode.Body
+	geom     ode.Geom
+	offset   ode.Vector3    // position relative to the chassis
+	rest     ode.Quaternion // rotation relative to the chassis
+	radius   float64
+	dt       float64
+	ground   *groundContact // deepest contact of the last collision pass
+	compound protocol.TireCompound
+	tire     TireState
+	vehicle  *Vehicle
+	ray      *rayWheel // raycast model only, no body or joint
 }
 
 // NewWheel ...
@@ -31,32 +43,75 @@ func NewWheel(ctx *Context, density, diameter, width float64) *Wheel {
 	mass := ode.NewMass()
 	mass.SetCylinder(density, 1, diameter/2, width) // 1: x-axis length = width
 	body.SetMass(mass)
-	geom := ctx.Space.NewCylinder(diameter/2, width)
+	geom := ctx.Dynamic.NewCylinder(diameter/2, width)
 	geom.SetBody(body)
 	joint := ctx.World.NewHinge2Joint(ode.JointGroup(0))
-	return &Wheel{Joint: joint, body: body, geom: geom}
+	w := &Wheel{Joint: joint, body: body, geom: geom, radius: diameter / 2}
+	body.SetData(w)
+	return w
 }
 
 func (w *Wheel) Destroy() {
+	if w.ray != nil {
+		w.geom.Destroy()
+		return
+	}
 	w.Joint.Destroy()
 	w.geom.Destroy()
 	w.body.Destroy()
 }
 
 func (w *Wheel) Position() ode.Vector3 {
+	if w.ray != nil {
+		return w.rayPosition()
+	}
 	return w.body.Position()
 }
 
 func (w *Wheel) Quaternion() ode.Quaternion {
+	if w.ray != nil {
+		return fromQuat(w.rayQuaternion())
+	}
 	return w.body.Quaternion()
 }
 
 func (w *Wheel) Rotation() ode.Matrix3 {
+	if w.ray != nil {
+		m := w.rayQuaternion().Mat4()
+		return ode.NewMatrix3(
+			m.At(0, 0), m.At(0, 1), m.At(0, 2),
+			m.At(1, 0), m.At(1, 1), m.At(1, 2),
+			m.At(2, 0), m.At(2, 1), m.At(2, 2),
+		)
+	}
 	return w.body.Rotation()
 }
 
-// Vehicle ...
+// steerAngle returns the steering angle in rad.
+func (w *Wheel) steerAngle() float64 {
+	if w.ray != nil {
+		return w.ray.steer
+	}
+	return w.Joint.Angle1()
+}
+
+// drive sets the wheel motor.
+func (w *Wheel) drive(vel, fmax float64) {
+	if w.ray != nil {
+		w.ray.vel, w.ray.fmax = vel, fmax
+		return
+	}
+	// 動輪目標速度rad/s
+	w.Joint.SetParam(ode.VelJtParam2, vel)
+	// 動輪トルク最大値Nm
+	w.Joint.SetParam(ode.FMaxJtParam2, fmax)
+}
+
+// Vehicle is a car.
 type Vehicle struct {
+	filterState
+	ctx       *Context
+	profile   protocol.VehicleProfile
 	body      ode.Body
 	geom      ode.Geom
 	wheels    []*Wheel
@@ -65,29 +120,53 @@ type Vehicle struct {
 	accel     float64
 	brake     float64
 	steering  float64
+	damage    protocol.Damage
+	sensors   *physics.Sensors
+	radio     *physics.Radio
 }
 
 // NewVehicle ...
 func NewVehicle(ctx *Context, profile protocol.VehicleProfile) *Vehicle {
 	body := ctx.World.NewBody()
-	geom := ctx.Space.NewBox(profile.BodyBox)
+	geom := ctx.Dynamic.NewBox(profile.BodyBox)
 	geom.SetBody(body)
 	mass := ode.NewMass()
 	mass.SetBox(profile.BodyDensity, profile.BodyBox)
 	body.SetMass(mass)
-	v := &Vehicle{body: body, geom: geom, wheels: []*Wheel{}}
+	v := &Vehicle{
+		ctx:     ctx,
+		profile: profile,
+		body:    body,
+		geom:    geom,
+		wheels:  []*Wheel{},
+		sensors: newSensors(ctx.Profile.Sensors),
+		radio:   newRadio(ctx.Profile),
+	}
+	body.SetData(v)
 	for i := 0; i < 4; i++ {
-		w := NewWheel(ctx,
-			profile.TireDensity,
-			profile.TireDiameter,
-			profile.TireWidth,
-		)
+		var w *Wheel
+		if profile.Model == ModelRaycast {
+			w = newRayWheel(ctx, profile)
+		} else {
+			w = NewWheel(ctx,
+				profile.TireDensity,
+				profile.TireDiameter,
+				profile.TireWidth,
+			)
+		}
+		w.vehicle = v
+		w.compound = profile.Compound
+		w.tire.Temperature = ctx.Profile.World.AmbientTemp
 		v.wheels = append(v.wheels, w)
 	}
 	v.tread = profile.Tread
 	v.wheelbase = profile.Wheelbase
-	camber := 15.0 // deg
+	camber := profile.Camber // deg
 	for i, w := range v.wheels {
+		if w.ray != nil {
+			w.offset = v.corner(i)
+			continue
+		}
 		w.Joint.Attach(v.body, w.body)
 		ax1 := mgl.HomogRotate3DX(mgl.DegToRad(camber)).Mul4x1(mgl.Vec4{0, 0, -1})
 		w.Joint.SetAxis1(ode.V3(ax1[0], ax1[1], ax1[2]))
@@ -106,23 +185,33 @@ func NewVehicle(ctx *Context, profile protocol.VehicleProfile) *Vehicle {
 		base := k + profile.SuspensionDamping
 		w.Joint.SetParam(ode.SuspensionCFMJtParam, k/base)
 		w.Joint.SetParam(ode.SuspensionERPJtParam, 1.0/base)
-		lr := 1.0
-		if i%2 == 0 {
-			lr = -1.0
-		}
-		fr := -1.0
-		if i/2 == 0 {
-			fr = 1.0
-		}
-		x := lr * v.tread / 2
-		y := fr * v.wheelbase / 2
-		z := -0.025
-		w.body.SetPosition(ode.V3(x, y, z))
+		w.offset = v.corner(i)
+		w.body.SetPosition(w.offset)
 		w.Joint.SetAnchor(w.Position())
+		w.rest = w.Quaternion()
 	}
+	v.damage.Suspension = make([]float64, len(v.wheels))
 	return v
 }
 
+// corner returns the wheel center of corner i relative to the chassis.
+func (v *Vehicle) corner(i int) ode.Vector3 {
+	lr := 1.0
+	if i%2 == 0 {
+		lr = -1.0
+	}
+	fr := -1.0
+	if i/2 == 0 {
+		fr = 1.0
+	}
+	return ode.V3(lr*v.tread/2, fr*v.wheelbase/2, -0.025)
+}
+
+// Kind ...
+func (v *Vehicle) Kind() string {
+	return protocol.KindCar
+}
+
 func (v *Vehicle) Destroy() {
 	for _, w := range v.wheels {
 		w.Destroy()
@@ -143,59 +232,173 @@ func (v *Vehicle) Rotation() ode.Matrix3 {
 	return v.body.Rotation()
 }
 
+// Attitude ...
+func (v *Vehicle) Attitude() protocol.Attitude {
+	return protocol.Attitude{Position: v.Position(), Quaternion: v.Quaternion()}
+}
+
+// Parts returns the wheel attitudes.
+func (v *Vehicle) Parts() []protocol.Attitude {
+	ws := make([]protocol.Attitude, len(v.wheels))
+	for i, w := range v.wheels {
+		ws[i] = protocol.Attitude{Position: w.Position(), Quaternion: w.Quaternion()}
+	}
+	return ws
+}
+
+// Profile returns the profile the vehicle was built with.
+func (v *Vehicle) Profile() protocol.VehicleProfile {
+	return v.profile
+}
+
 func (v *Vehicle) Wheel(index int) *Wheel {
 	return v.wheels[index]
 }
 
 func (v *Vehicle) Update(dt float64) {
+	world := v.ctx.Profile.World
+	for _, wheel := range v.wheels {
+		wheel.dt = dt
+		wheel.heat(dt, world.Mu, world.AmbientTemp)
+		if wheel.ground != nil {
+			pos := wheel.ground.pos
+			if k := v.ctx.track.key(ode.V3(pos[0], pos[1], pos[2])); !wheel.tire.OnTrack || k != wheel.tire.Cell {
+				v.ctx.track.pass(k)
+				wheel.tire.Cell, wheel.tire.OnTrack = k, true
+			}
+		}
+		wheel.ground = nil
+		if wheel.ray != nil {
+			wheel.place()
+		}
+	}
 	for _, wheel := range v.wheels[:2] {
-		d := (v.steering / 3.0) - wheel.Joint.Angle1()
+		d := (v.steering / 3.0) - wheel.steerAngle()
 		if d > 2*math.Pi {
 			d = 2 * math.Pi
 		}
 		if d < -2*math.Pi {
 			d = -2 * math.Pi
 		}
+		if wheel.ray != nil {
+			// 操舵: hinge2と同じ速度, 最大角1rad
+			a := wheel.ray.steer + d*8*dt*1e3*dt*(1-v.damage.Steering)
+			wheel.ray.steer = math.Max(-1.0, math.Min(1.0, a))
+			continue
+		}
 		wheel.Joint.SetParam(ode.VelJtParam, d*8*dt*1e3)
 	}
 }
 
+func (v *Vehicle) react(dt float64) {
+	v.suspend(dt)
+}
+
+func (v *Vehicle) geoms() []ode.Geom {
+	gs := []ode.Geom{v.geom}
+	for _, w := range v.wheels {
+		gs = append(gs, w.geom)
+	}
+	return gs
+}
+
+// Input returns the last control input applied by Set.
+func (v *Vehicle) Input() protocol.Input {
+	return protocol.Input{
+		Steering: -v.steering,
+		Accel:    v.accel,
+		Brake:    v.brake,
+	}
+}
+
+// Sleeping reports whether the vehicle has been auto-disabled.
+func (v *Vehicle) Sleeping() bool {
+	return !v.body.Enabled()
+}
+
+// Wake re-enables the chassis and wheel bodies.
+func (v *Vehicle) Wake() {
+	v.body.SetEnabled(true)
+	for _, w := range v.wheels {
+		if w.ray == nil {
+			w.body.SetEnabled(true)
+		}
+	}
+}
+
+// Set sends in over the radio.
 func (v *Vehicle) Set(in *protocol.Input) {
+	if in, ok := v.radio.Send(*in); ok {
+		v.apply(&in)
+	}
+}
+
+// apply takes in as the control input.
+func (v *Vehicle) apply(in *protocol.Input) {
+	if in.Steering != 0 || in.Accel != 0 || in.Brake != 0 {
+		v.Wake()
+	}
 	v.steering = -in.Steering
+	v.accel = in.Accel
+	v.brake = in.Brake
 	for i, wheel := range v.wheels {
 		if in.Brake > 0.5 {
 			brake := (in.Brake-0.5)*2 - in.Accel
-			// 動輪目標速度rad/s
-			wheel.Joint.SetParam(ode.VelJtParam2, 0.0)
-			// 動輪トルク最大値Nm
-			wheel.Joint.SetParam(ode.FMaxJtParam2, brake*1e-3)
+			wheel.drive(0.0, brake*1e-3)
 		} else {
 			factor := 0.55
 			if i < 2 {
 				factor = 0.45
 			}
-			// 動輪目標速度rad/s
-			wheel.Joint.SetParam(ode.VelJtParam2, 160.0)
-			// 動輪トルク最大値Nm
-			wheel.Joint.SetParam(ode.FMaxJtParam2, factor*in.Accel*1e-3)
+			wheel.drive(160.0*v.profile.FinalDrive, factor*in.Accel*1e-3*(1-v.damage.Motor)/v.profile.FinalDrive)
 		}
 	}
 }
 
 func (v *Vehicle) SetPosition(pos ode.Vector3) {
 	for i, w := range v.wheels {
-		lr := 1.0
-		if i%2 == 0 {
-			lr = -1.0
+		if w.ray != nil {
+			continue
 		}
-		fr := -1.0
-		if i/2 == 0 {
-			fr = 1.0
+		c := v.corner(i)
+		w.body.SetPosition(ode.V3(pos[0]+c[0], pos[1]+c[1], pos[2]+c[2]))
+	}
+	v.body.SetPosition(pos)
+}
+
+// SetPose places the chassis at pos with rotation quat and moves the wheels
+// along with it.
+func (v *Vehicle) SetPose(pos ode.Vector3, quat ode.Quaternion) {
+	q := toQuat(quat)
+	for _, w := range v.wheels {
+		if w.ray != nil {
+			continue
 		}
-		x := pos[0] + lr*v.tread/2
-		y := pos[1] + fr*v.wheelbase/2
-		z := pos[2] - 0.025
-		w.body.SetPosition(ode.V3(x, y, z))
+		p := q.Rotate(mgl.Vec3{w.offset[0], w.offset[1], w.offset[2]})
+		w.body.SetPosition(ode.V3(pos[0]+p[0], pos[1]+p[1], pos[2]+p[2]))
+		w.body.SetQuaternion(fromQuat(q.Mul(toQuat(w.rest))))
 	}
 	v.body.SetPosition(pos)
+	v.body.SetQuaternion(quat)
+}
+
+// SetVelocity sets the chassis velocities and carries the wheels along.
+func (v *Vehicle) SetVelocity(linear, angular ode.Vector3) {
+	v.body.SetLinearVelocity(linear)
+	v.body.SetAngularVelocity(angular)
+	for _, w := range v.wheels {
+		if w.ray != nil {
+			continue
+		}
+		w.body.SetLinearVelocity(v.body.PointVel(w.Position()))
+		w.body.SetAngularVelocity(angular)
+	}
+}
+
+func toQuat(q ode.Quaternion) mgl.Quat {
+	return mgl.Quat{W: q[0], V: mgl.Vec3{q[1], q[2], q[3]}}
+}
+
+func fromQuat(q mgl.Quat) ode.Quaternion {
+	return ode.Quaternion{q.W, q.V[0], q.V[1], q.V[2]}
 }
@@ -0,0 +1,141 @@
+// Package physics defines the simulation backends the server can run on.
+// Backends register themselves by name from an init function; the ode
+// backend lives in models and needs cgo, the simple backend is pure Go.
+package physics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nobonobo/rccargo/protocol"
+)
+
+// MaxTeams is the number of teams of the team collision mode; the ode
+// backend keeps one collide bit per team.
+const MaxTeams = 27
+
+// World is a running simulation of a track, its vehicles and objects.
+// All methods are safe for concurrent use.
+type World interface {
+	// Iter advances the simulation by one real-time tick of length step.
+	Iter(step time.Duration)
+	GetProfile() protocol.Profile
+	ApplyProfile(profile protocol.Profile)
+
+	// AddTriMesh adds static track geometry: xyz vertex triples and
+	// triangle vertex indices.
+	AddTriMesh(vertices []float64, index []uint32)
+	// AddPrimitive adds static track geometry of shape "box" (size: lengths),
+	// "cylinder" ({diameter, diameter, length} along its z axis), "sphere"
+	// ({diameter, diameter, diameter}) or "plane" (through body.Position,
+	// facing its z axis, size unused), placed at body.
+	AddPrimitive(name, shape string, body protocol.Attitude, size []float64) error
+	// SetDriverStand sets the antenna position players transmit from for
+	// the radio model, nil for a track without a driver stand.
+	SetDriverStand(pos []float64)
+	// AddObject adds a loose track object of kind, its shape fitted to size
+	// in body coordinates, placed at body.
+	AddObject(name, kind string, body protocol.Attitude, size []float64) error
+	ResetObjects() int
+	IterObjects(f func(*protocol.Object))
+	// AddKinematic adds an animated track element: a triangle mesh in
+	// body coordinates moved along path regardless of forces.
+	AddKinematic(name string, vertices []float64, index []uint32, path Path) error
+	IterKinematics(f func(*protocol.Kinematic))
+
+	// AddVehicle adds a vehicle of kind, protocol.KindCar or
+	// protocol.KindQuadcopter, replacing any vehicle of the same name.
+	AddVehicle(name, kind string, pos []float64) (Vehicle, error)
+	GetVehicle(name string) Vehicle // nil when unknown
+	RmVehicle(name string)
+	ResetVehicle(name string, pos []float64) Vehicle
+	SetVehicleProfile(name string, profile protocol.VehicleProfile) Vehicle
+	IterVehicles(f func(string, Vehicle))
+	SetTeam(name string, team int) error
+
+	SetWetness(wetness float64)
+	Wetness() float64
+
+	Pause()
+	Resume()
+	Paused() bool
+	StepOnce(n int)
+	SetTimeScale(scale float64) error
+	TimeScale() float64
+}
+
+// Vehicle is a car or quadcopter controlled by a player.
+type Vehicle interface {
+	Kind() string
+	Set(in *protocol.Input)
+	Input() protocol.Input
+	Profile() protocol.VehicleProfile // car setup, zero for other kinds
+	Sleeping() bool
+	Attitude() protocol.Attitude
+	// Parts returns the attitudes of the moving parts drawn apart from the
+	// body: the wheels of a car, the rotors of a quadcopter.
+	Parts() []protocol.Attitude
+	Telemetry() *protocol.Telemetry
+	// SignalLost reports whether the receiver holds the failsafe input
+	// because no input arrived for the failsafe timeout.
+	SignalLost() bool
+	// Sensors returns the sensor readings taken since the previous call.
+	Sensors() *protocol.Sensors
+}
+
+// Path is the pose of a kinematic body at t simulated seconds.
+type Path func(t float64) protocol.Attitude
+
+// Factory creates a world with profile applied.
+type Factory func(profile protocol.Profile) World
+
+var (
+	mu       sync.Mutex
+	backends = map[string]Factory{}
+)
+
+// Register makes a backend available under name.
+func Register(name string, f Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, dup := backends[name]; dup {
+		panic("physics: Register called twice for backend " + name)
+	}
+	backends[name] = f
+}
+
+// Backends returns the names of the registered backends.
+func Backends() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	names := []string{}
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Default returns "ode" when it is built in, otherwise "simple".
+func Default() string {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := backends["ode"]; ok {
+		return "ode"
+	}
+	return "simple"
+}
+
+// New creates a world on the named backend.
+func New(name string, profile protocol.Profile) (World, error) {
+	mu.Lock()
+	f, ok := backends[name]
+	mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown physics backend: %s (have %s)", name, strings.Join(Backends(), ", "))
+	}
+	return f(profile), nil
+}
@@ -0,0 +1,81 @@
+package physics
+
+import (
+	"math"
+
+	"github.com/nobonobo/rccargo/protocol"
+)
+
+// RotorSpeed is the rotor speed in rad/s at full thrust, for rendering.
+const RotorSpeed = 1500
+
+// RotorSpin is the sign of each rotor's yaw reaction on the frame, in the
+// wheel order of a car: front left, front right, rear left, rear right.
+// Diagonal rotors turn the same way.
+var RotorSpin = [4]float64{1, -1, -1, 1}
+
+// RotorOffset returns the position of rotor i relative to the frame center.
+func RotorOffset(p protocol.QuadcopterProfile, i int) [3]float64 {
+	x, y := p.FrameBox[0]/2, p.FrameBox[1]/2
+	if i%2 == 0 {
+		x = -x
+	}
+	if i/2 != 0 {
+		y = -y
+	}
+	return [3]float64{x, y, p.FrameBox[2] / 2}
+}
+
+// MaxRotorThrust is the thrust of one rotor at full power in N.
+func MaxRotorThrust(p protocol.QuadcopterProfile, mass, gravity float64) float64 {
+	return p.ThrustRatio * mass * gravity / 4
+}
+
+// RotorRate returns how fast rotor i turns around the frame z axis at
+// thrust, for rendering; the frame feels the opposite reaction.
+func RotorRate(i int, thrust, max float64) float64 {
+	if max <= 0 {
+		return 0
+	}
+	return -RotorSpin[i] * RotorSpeed * math.Sqrt(thrust/max)
+}
+
+// FlightState is what the flight controller of a quadcopter senses.
+type FlightState struct {
+	Up      [3]float64 // world up in frame coordinates
+	Omega   [3]float64 // rad/s in frame coordinates
+	Climb   float64    // m/s, world z velocity
+	Mass    float64    // kg
+	Inertia [3]float64 // kg*m^2 around the frame axes
+	Gravity float64    // m/s^2, positive down
+}
+
+// RotorThrust is the flight controller of a quadcopter. It holds the tilt
+// asked for by pitch and roll, the yaw rate asked for by steering and the
+// climb rate asked for by accel and brake, and mixes them into the thrust
+// of each rotor in N. With the sticks centered it hovers.
+func RotorThrust(p protocol.QuadcopterProfile, in protocol.Input, s FlightState) [4]float64 {
+	tilt := p.MaxTilt * math.Pi / 180
+	k := p.Response
+	// tilt around the frame x (nose up) and y (right side down) axes
+	ax := math.Atan2(s.Up[1], s.Up[2])
+	ay := math.Atan2(-s.Up[0], s.Up[2])
+	tx := s.Inertia[0] * (k*k*(-clamp(in.Pitch, -1)*tilt-ax) - 2*k*s.Omega[0])
+	ty := s.Inertia[1] * (k*k*(clamp(in.Roll, -1)*tilt-ay) - 2*k*s.Omega[1])
+	tz := s.Inertia[2] * k * (-clamp(in.Steering, -1)*p.MaxYawRate*math.Pi/180 - s.Omega[2])
+	climb := (clamp(in.Accel, 0) - clamp(in.Brake, 0)) * p.MaxClimb
+	lift := s.Mass * (s.Gravity + k*(climb-s.Climb)) / math.Max(s.Up[2], 0.5)
+	max := MaxRotorThrust(p, s.Mass, s.Gravity)
+	var thrust [4]float64
+	for i := range thrust {
+		o := RotorOffset(p, i)
+		f := lift/4 + tx/(4*o[1]) - ty/(4*o[0]) + tz/(4*p.TorqueRatio*RotorSpin[i])
+		thrust[i] = math.Max(0, math.Min(max, f))
+	}
+	return thrust
+}
+
+// clamp limits a stick input to [min, 1].
+func clamp(v, min float64) float64 {
+	return math.Max(min, math.Min(1, v))
+}
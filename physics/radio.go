@@ -0,0 +1,179 @@
+package physics
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+
+	"github.com/nobonobo/rccargo/protocol"
+)
+
+// StandEye is the height in m of the driver's eyes and antenna above the
+// top of the driver stand.
+const StandEye = 1.6
+
+// Signal returns the link quality, 0: none to 1: full, of a vehicle dist m
+// away from the driver stand, in sight of it or not.
+func Signal(p protocol.RadioProfile, dist float64, sight bool) float64 {
+	if p.Range <= 0 {
+		return 1
+	}
+	q := 1.0
+	if dist > p.Range {
+		q = 0
+		if p.Fade > 0 {
+			q = math.Max(0, 1-(dist-p.Range)/p.Fade)
+		}
+	}
+	if !sight {
+		q *= 1 - p.Obstruction
+	}
+	return q
+}
+
+// Radio is the receiver of a vehicle. Inputs sent from the driver stand
+// arrive after the link latency or get lost, both more likely as the
+// signal weakens; the newest input to arrive wins. Without radio
+// modelling inputs arrive right away. When nothing arrives for the
+// failsafe timeout the receiver holds the failsafe input by itself until
+// the next input. Backends update the signal after every step. It is safe
+// for concurrent use.
+type Radio struct {
+	mu       sync.Mutex
+	profile  protocol.RadioProfile
+	failsafe protocol.FailsafeProfile
+	src      *source
+	rnd      *rand.Rand
+	signal   float64
+	now      float64 // simulated s of the last Receive
+	heard    float64 // simulated s of the last input received
+	live     bool    // an input arrived since the failsafe
+	lost     bool    // failsafe engaged
+	queue    []Packet
+}
+
+// NewRadio creates a receiver with its own noise source.
+func NewRadio(profile protocol.RadioProfile, failsafe protocol.FailsafeProfile, seed int64) *Radio {
+	src := newSource(seed)
+	return &Radio{profile: profile, failsafe: failsafe, src: src, rnd: rand.New(src), signal: 1}
+}
+
+// Packet is an input on its way to the receiver.
+type Packet struct {
+	At    float64        `json:"at"` // simulated s of arrival
+	Input protocol.Input `json:"input"`
+}
+
+// RadioState is the state of a receiver for snapshots.
+type RadioState struct {
+	Seed   int64    `json:"seed"`
+	Drawn  uint64   `json:"drawn"` // values drawn from the seed
+	Signal float64  `json:"signal"`
+	Now    float64  `json:"now"`
+	Heard  float64  `json:"heard"`
+	Live   bool     `json:"live,omitempty"`
+	Lost   bool     `json:"lost,omitempty"`
+	Queue  []Packet `json:"queue,omitempty"`
+}
+
+// State ...
+func (r *Radio) State() RadioState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return RadioState{
+		Seed:   r.src.seed,
+		Drawn:  r.src.drawn,
+		Signal: r.signal,
+		Now:    r.now,
+		Heard:  r.heard,
+		Live:   r.live,
+		Lost:   r.lost,
+		Queue:  append([]Packet(nil), r.queue...),
+	}
+}
+
+// SetState restores a state taken by State.
+func (r *Radio) SetState(s RadioState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.src.restore(s.Seed, s.Drawn)
+	r.signal, r.now, r.heard = s.Signal, s.Now, s.Heard
+	r.live, r.lost = s.Live, s.Lost
+	r.queue = append([]Packet(nil), s.Queue...)
+}
+
+// SetProfile ...
+func (r *Radio) SetProfile(profile protocol.RadioProfile, failsafe protocol.FailsafeProfile) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.profile, r.failsafe = profile, failsafe
+}
+
+// SetSignal sets the link quality from the vehicle position.
+func (r *Radio) SetSignal(q float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.signal = q
+}
+
+// Signal ...
+func (r *Radio) Signal() float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.signal
+}
+
+func (r *Radio) off() bool {
+	return r.profile.Range <= 0
+}
+
+// Send transmits in. Without radio modelling it returns in to apply right
+// away; otherwise in is queued for Receive or lost.
+func (r *Radio) Send(in protocol.Input) (protocol.Input, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.off() {
+		r.queue = nil
+		r.heard, r.live, r.lost = r.now, true, false
+		return in, true
+	}
+	if r.rnd.Float64() >= r.signal {
+		return protocol.Input{}, false // dropout
+	}
+	p := r.profile
+	r.queue = append(r.queue, Packet{r.now + p.Latency + (p.MaxLatency-p.Latency)*(1-r.signal), in})
+	return protocol.Input{}, false
+}
+
+// Receive returns the newest input arrived by the simulated time now, or
+// the failsafe input once nothing has arrived for the failsafe timeout.
+func (r *Radio) Receive(now float64) (protocol.Input, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.now = now
+	last := -1
+	for i, p := range r.queue {
+		if p.At <= now {
+			last = i
+		}
+	}
+	if last >= 0 {
+		// older inputs still on their way are stale
+		in := r.queue[last].Input
+		r.queue = r.queue[last+1:]
+		r.heard, r.live, r.lost = now, true, false
+		return in, true
+	}
+	if t := r.failsafe.Timeout; t > 0 && r.live && now-r.heard >= t {
+		r.live, r.lost = false, true
+		return r.failsafe.Input(), true
+	}
+	return protocol.Input{}, false
+}
+
+// Lost reports whether the receiver holds the failsafe input.
+func (r *Radio) Lost() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lost
+}
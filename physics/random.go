@@ -0,0 +1,33 @@
+package physics
+
+import "math/rand"
+
+// source is a random source whose state can be saved and restored: the
+// seed and the number of values drawn since.
+type source struct {
+	src   rand.Source
+	seed  int64
+	drawn uint64
+}
+
+func newSource(seed int64) *source {
+	return &source{src: rand.NewSource(seed), seed: seed}
+}
+
+func (s *source) Int63() int64 {
+	s.drawn++
+	return s.src.Int63()
+}
+
+func (s *source) Seed(seed int64) {
+	s.src.Seed(seed)
+	s.seed, s.drawn = seed, 0
+}
+
+// restore reseeds s and draws again what it had drawn.
+func (s *source) restore(seed int64, drawn uint64) {
+	s.Seed(seed)
+	for s.drawn < drawn {
+		s.Int63()
+	}
+}
@@ -0,0 +1,172 @@
+package physics
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+
+	mgl "github.com/go-gl/mathgl/mgl64"
+
+	"github.com/nobonobo/rccargo/protocol"
+)
+
+// maxSamples bounds the readings queued between two Drain calls; older
+// readings are dropped first.
+const maxSamples = 256
+
+// Motion is the state of a vehicle body after a step, in world axes.
+type Motion struct {
+	Time            float64 // simulated s
+	Position        [3]float64
+	Velocity        [3]float64
+	AngularVelocity [3]float64
+	Quaternion      [4]float64 // w, x, y, z
+	Gravity         [3]float64
+	Wheels          []float64 // rad/s around each axle, rolling forward positive
+}
+
+// Sensors simulates the IMU, wheel encoders and GPS receiver of a vehicle.
+// Backends feed it the body motion after every step; readings queue up
+// until Drain. It is safe for concurrent use.
+type Sensors struct {
+	mu        sync.Mutex
+	profile   protocol.SensorProfile
+	src       *source
+	rnd       *rand.Rand
+	accelBias mgl.Vec3
+	gyroBias  mgl.Vec3
+	last      *Motion
+	wheels    []float64 // rad turned since creation
+	nextFix   float64   // simulated s
+	out       protocol.Sensors
+}
+
+// NewSensors creates sensors with their own noise source and bias.
+func NewSensors(profile protocol.SensorProfile, seed int64) *Sensors {
+	src := newSource(seed)
+	s := &Sensors{profile: profile, src: src, rnd: rand.New(src)}
+	for i := 0; i < 3; i++ {
+		s.accelBias[i] = s.rnd.NormFloat64() * profile.AccelBias
+		s.gyroBias[i] = s.rnd.NormFloat64() * profile.GyroBias
+	}
+	return s
+}
+
+// SensorState is the state of the sensors for snapshots. Readings not
+// drained yet are not part of it.
+type SensorState struct {
+	Seed      int64      `json:"seed"`
+	Drawn     uint64     `json:"drawn"` // values drawn from the seed
+	AccelBias [3]float64 `json:"accelBias"`
+	GyroBias  [3]float64 `json:"gyroBias"`
+	Last      *Motion    `json:"last,omitempty"`
+	Wheels    []float64  `json:"wheels,omitempty"`
+	NextFix   float64    `json:"nextFix"`
+}
+
+// State ...
+func (s *Sensors) State() SensorState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := SensorState{
+		Seed:      s.src.seed,
+		Drawn:     s.src.drawn,
+		AccelBias: [3]float64(s.accelBias),
+		GyroBias:  [3]float64(s.gyroBias),
+		Wheels:    append([]float64(nil), s.wheels...),
+		NextFix:   s.nextFix,
+	}
+	if s.last != nil {
+		last := *s.last
+		last.Wheels = append([]float64(nil), last.Wheels...)
+		st.Last = &last
+	}
+	return st
+}
+
+// SetState restores a state taken by State.
+func (s *Sensors) SetState(st SensorState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.src.restore(st.Seed, st.Drawn)
+	s.accelBias, s.gyroBias = mgl.Vec3(st.AccelBias), mgl.Vec3(st.GyroBias)
+	s.wheels = append([]float64(nil), st.Wheels...)
+	s.nextFix = st.NextFix
+	s.last = nil
+	if st.Last != nil {
+		last := *st.Last
+		s.last = &last
+	}
+}
+
+// SetProfile changes noise and rates, keeping the bias drawn at creation.
+func (s *Sensors) SetProfile(profile protocol.SensorProfile) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.profile = profile
+}
+
+// Step samples the sensors for the motion m after a step of dt.
+func (s *Sensors) Step(m Motion, dt float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q := mgl.Quat{W: m.Quaternion[0], V: mgl.Vec3{m.Quaternion[1], m.Quaternion[2], m.Quaternion[3]}}
+	inv := q.Inverse()
+	// an accelerometer measures acceleration minus gravity
+	accel := mgl.Vec3{}
+	if s.last != nil && dt > 0 {
+		for i := range accel {
+			accel[i] = (m.Velocity[i] - s.last.Velocity[i]) / dt
+		}
+	}
+	accel = inv.Rotate(accel.Sub(mgl.Vec3(m.Gravity))).Add(s.accelBias)
+	gyro := inv.Rotate(mgl.Vec3(m.AngularVelocity)).Add(s.gyroBias)
+	for i := 0; i < 3; i++ {
+		accel[i] += s.rnd.NormFloat64() * s.profile.AccelNoise
+		gyro[i] += s.rnd.NormFloat64() * s.profile.GyroNoise
+	}
+	if len(s.wheels) != len(m.Wheels) {
+		s.wheels = make([]float64, len(m.Wheels))
+	}
+	counts := make([]int64, len(m.Wheels))
+	for i, w := range m.Wheels {
+		s.wheels[i] += w * dt
+		counts[i] = int64(math.Floor(s.wheels[i] / (2 * math.Pi) * float64(s.profile.EncoderCounts)))
+	}
+	if len(s.out.IMU) == maxSamples {
+		s.out.IMU = s.out.IMU[1:]
+	}
+	s.out.IMU = append(s.out.IMU, protocol.IMUSample{
+		Time:     m.Time,
+		Accel:    []float64{accel[0], accel[1], accel[2]},
+		Gyro:     []float64{gyro[0], gyro[1], gyro[2]},
+		Encoders: counts,
+	})
+	if s.profile.GPSRate > 0 && m.Time >= s.nextFix {
+		s.nextFix = m.Time + 1/s.profile.GPSRate
+		fix := protocol.GPSFix{Time: m.Time, Position: make([]float64, 3)}
+		for i := range fix.Position {
+			fix.Position[i] = m.Position[i] + s.rnd.NormFloat64()*s.profile.GPSNoise
+		}
+		if len(s.out.GPS) == maxSamples {
+			s.out.GPS = s.out.GPS[1:]
+		}
+		s.out.GPS = append(s.out.GPS, fix)
+	}
+	s.last = &m
+}
+
+// Drain returns the readings queued since the previous call.
+func (s *Sensors) Drain() *protocol.Sensors {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := s.out
+	s.out = protocol.Sensors{}
+	if out.IMU == nil {
+		out.IMU = []protocol.IMUSample{}
+	}
+	if out.GPS == nil {
+		out.GPS = []protocol.GPSFix{}
+	}
+	return &out
+}
@@ -0,0 +1,181 @@
+package simple
+
+import (
+	"math"
+
+	mgl "github.com/go-gl/mathgl/mgl64"
+)
+
+// cellSize is the grid resolution of the triangle index in m.
+const cellSize = 1.0
+
+// minFloorZ is the smallest normal z of a triangle a car can stand on.
+const minFloorZ = 0.5
+
+var up = mgl.Vec3{0, 0, 1}
+
+type triangle struct {
+	a, b, c mgl.Vec3
+	n       mgl.Vec3 // unit normal, pointing up
+}
+
+// height returns the height of the triangle plane at x, y when the point
+// lies inside the triangle seen from above.
+func (t *triangle) height(x, y float64) (float64, bool) {
+	e1, e2 := t.b.Sub(t.a), t.c.Sub(t.a)
+	d := e1[0]*e2[1] - e2[0]*e1[1]
+	if math.Abs(d) < 1e-12 {
+		return 0, false // vertical
+	}
+	px, py := x-t.a[0], y-t.a[1]
+	u := (px*e2[1] - e2[0]*py) / d
+	w := (e1[0]*py - px*e1[1]) / d
+	if u < 0 || w < 0 || u+w > 1 {
+		return 0, false
+	}
+	return t.a[2] + u*e1[2] + w*e2[2], true
+}
+
+type cellKey [2]int
+
+func keyOf(x, y float64) cellKey {
+	return cellKey{int(math.Floor(x / cellSize)), int(math.Floor(y / cellSize))}
+}
+
+// ground answers height queries against the static track triangles and
+// planes and the kinematic elements where they are this step. Without any
+// static triangles or planes it is the plane z = 0.
+type ground struct {
+	tris   []triangle
+	cells  map[cellKey][]int
+	planes []plane
+	moving []*ground
+}
+
+func newGround() *ground {
+	return &ground{cells: map[cellKey][]int{}}
+}
+
+func (g *ground) add(vertices []float64, index []uint32) {
+	for i := 0; i+2 < len(index); i += 3 {
+		var p [3]mgl.Vec3
+		for j := range p {
+			k := int(index[i+j]) * 3
+			p[j] = mgl.Vec3{vertices[k], vertices[k+1], vertices[k+2]}
+		}
+		n := p[1].Sub(p[0]).Cross(p[2].Sub(p[0]))
+		if n.Len() == 0 {
+			continue
+		}
+		n = n.Normalize()
+		if n[2] < 0 {
+			n = n.Mul(-1)
+		}
+		g.tris = append(g.tris, triangle{p[0], p[1], p[2], n})
+		id := len(g.tris) - 1
+		lo := keyOf(math.Min(p[0][0], math.Min(p[1][0], p[2][0])), math.Min(p[0][1], math.Min(p[1][1], p[2][1])))
+		hi := keyOf(math.Max(p[0][0], math.Max(p[1][0], p[2][0])), math.Max(p[0][1], math.Max(p[1][1], p[2][1])))
+		for x := lo[0]; x <= hi[0]; x++ {
+			for y := lo[1]; y <= hi[1]; y++ {
+				k := cellKey{x, y}
+				g.cells[k] = append(g.cells[k], id)
+			}
+		}
+	}
+}
+
+// floor returns the highest floor at x, y not above z and its normal.
+func (g *ground) floor(x, y, z float64) (float64, mgl.Vec3, bool) {
+	best, n := math.Inf(-1), up
+	if len(g.tris) == 0 && len(g.planes) == 0 {
+		best = 0
+	}
+	for _, p := range g.planes {
+		if h, ok := p.height(x, y); ok && p.n[2] >= minFloorZ && h <= z && h > best {
+			best, n = h, p.n
+		}
+	}
+	for _, m := range g.moving {
+		if h, mn, ok := m.floor(x, y, z); ok && h > best {
+			best, n = h, mn
+		}
+	}
+	for _, id := range g.cells[keyOf(x, y)] {
+		t := &g.tris[id]
+		if t.n[2] < minFloorZ {
+			continue
+		}
+		if h, ok := t.height(x, y); ok && h <= z && h > best {
+			best, n = h, t.n
+		}
+	}
+	return best, n, !math.IsInf(best, -1)
+}
+
+// blocked reports whether any surface at x, y lies between lo and hi.
+func (g *ground) blocked(x, y, lo, hi float64) bool {
+	for _, p := range g.planes {
+		if h, ok := p.height(x, y); ok && h > lo && h < hi {
+			return true
+		}
+	}
+	for _, m := range g.moving {
+		if m.blocked(x, y, lo, hi) {
+			return true
+		}
+	}
+	for _, id := range g.cells[keyOf(x, y)] {
+		if h, ok := g.tris[id].height(x, y); ok && h > lo && h < hi {
+			return true
+		}
+	}
+	return false
+}
+
+// crosses reports whether the segment from a to b passes through the
+// triangle.
+func (t *triangle) crosses(a, b mgl.Vec3) bool {
+	d, e1, e2 := b.Sub(a), t.b.Sub(t.a), t.c.Sub(t.a)
+	p := d.Cross(e2)
+	det := e1.Dot(p)
+	if math.Abs(det) < 1e-12 {
+		return false // parallel
+	}
+	s := a.Sub(t.a)
+	u := s.Dot(p) / det
+	if u < 0 || u > 1 {
+		return false
+	}
+	q := s.Cross(e1)
+	v := d.Dot(q) / det
+	if v < 0 || u+v > 1 {
+		return false
+	}
+	f := e2.Dot(q) / det
+	return f >= 0 && f <= 1
+}
+
+// sight reports whether no triangle lies between a and b.
+func (g *ground) sight(a, b mgl.Vec3) bool {
+	for _, p := range g.planes {
+		if (p.n.Dot(a)-p.d)*(p.n.Dot(b)-p.d) < 0 {
+			return false
+		}
+	}
+	d := b.Sub(a)
+	n := int(math.Ceil(math.Hypot(d[0], d[1])/(cellSize/2))) + 1
+	seen := map[int]bool{}
+	for i := 0; i <= n; i++ {
+		p := a.Add(d.Mul(float64(i) / float64(n)))
+		for _, id := range g.cells[keyOf(p[0], p[1])] {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			if g.tris[id].crosses(a, b) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,90 @@
+package simple
+
+import (
+	"fmt"
+	"reflect"
+
+	mgl "github.com/go-gl/mathgl/mgl64"
+
+	"github.com/nobonobo/rccargo/physics"
+	"github.com/nobonobo/rccargo/protocol"
+)
+
+// kinematic is an animated track element. Its triangles join the floor
+// and walls where it is each step; it does not carry what stands on it.
+type kinematic struct {
+	name     string
+	vertices []mgl.Vec3 // body coordinates
+	index    []uint32
+	path     physics.Path
+	pose     protocol.Attitude
+	ground   *ground
+}
+
+func newKinematic(name string, vertices []float64, index []uint32, path physics.Path) *kinematic {
+	k := &kinematic{name: name, index: index, path: path}
+	for i := 0; i+2 < len(vertices); i += 3 {
+		k.vertices = append(k.vertices, mgl.Vec3{vertices[i], vertices[i+1], vertices[i+2]})
+	}
+	return k
+}
+
+// move rebuilds the triangles of k at its pose at now. It reports whether
+// k moved.
+func (k *kinematic) move(now float64) bool {
+	pose := k.path(now)
+	if k.ground != nil && reflect.DeepEqual(pose, k.pose) {
+		return false
+	}
+	k.pose = pose
+	p, q := k.pose.Position, k.pose.Quaternion
+	rot := mgl.Quat{W: q[0], V: mgl.Vec3{q[1], q[2], q[3]}}
+	world := make([]float64, 0, len(k.vertices)*3)
+	for _, v := range k.vertices {
+		w := rot.Rotate(v).Add(mgl.Vec3{p[0], p[1], p[2]})
+		world = append(world, w[0], w[1], w[2])
+	}
+	k.ground = newGround()
+	k.ground.add(world, k.index)
+	return true
+}
+
+// AddKinematic ...
+func (w *World) AddKinematic(name string, vertices []float64, index []uint32, path physics.Path) error {
+	w.Lock()
+	defer w.Unlock()
+	k := newKinematic(name, vertices, index, path)
+	k.move(w.time)
+	if len(k.ground.tris) == 0 {
+		return fmt.Errorf("%s: no triangles", name)
+	}
+	w.kinematics = append(w.kinematics, k)
+	w.ground.moving = append(w.ground.moving, k.ground)
+	return nil
+}
+
+// IterKinematics ...
+func (w *World) IterKinematics(f func(*protocol.Kinematic)) {
+	w.RLock()
+	defer w.RUnlock()
+	for _, k := range w.kinematics {
+		f(&protocol.Kinematic{Name: k.name, Body: k.pose})
+	}
+}
+
+// moveKinematics puts the kinematic elements where they are at now and
+// wakes the crafts over the moving ones.
+func (w *World) moveKinematics(now float64) {
+	for i, k := range w.kinematics {
+		if !k.move(now) {
+			continue
+		}
+		w.ground.moving[i] = k.ground
+		for _, v := range w.vehicles {
+			pos := v.body().pos
+			if len(k.ground.cells[keyOf(pos[0], pos[1])]) > 0 {
+				v.wake()
+			}
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package simple
+
+import (
+	"fmt"
+	"math"
+
+	mgl "github.com/go-gl/mathgl/mgl64"
+
+	"github.com/nobonobo/rccargo/protocol"
+)
+
+// object is a loose track object. It slides on the floor, keeping the
+// orientation the track gave it, and is pushed around by cars.
+type object struct {
+	name   string
+	shape  string
+	size   []float64 // box lengths or {diameter, diameter, length}
+	radius float64   // seen from above
+	mass   float64
+	home   mgl.Vec3
+	rot    []float64 // quaternion
+	pos    mgl.Vec3
+	vel    mgl.Vec3
+}
+
+func newObject(name string, profile protocol.ObjectProfile, body protocol.Attitude, size []float64) (*object, error) {
+	p := body.Position
+	o := &object{name: name, shape: profile.Shape, home: mgl.Vec3{p[0], p[1], p[2]}, rot: body.Quaternion}
+	switch profile.Shape {
+	case "box":
+		o.size = []float64{size[0], size[1], size[2]}
+		o.radius = math.Max(size[0], size[1]) / 2
+		o.mass = profile.Density * size[0] * size[1] * size[2]
+	case "cylinder":
+		r := (size[0] + size[1]) / 4
+		o.size = []float64{2 * r, 2 * r, size[2]}
+		o.radius = r
+		o.mass = profile.Density * math.Pi * r * r * size[2]
+	case "sphere":
+		r := (size[0] + size[1] + size[2]) / 6
+		o.size = []float64{2 * r, 2 * r, 2 * r}
+		o.radius = r
+		o.mass = profile.Density * 4 / 3 * math.Pi * r * r * r
+	default:
+		return nil, fmt.Errorf("%s: unknown shape %q", name, profile.Shape)
+	}
+	o.reset()
+	return o, nil
+}
+
+func (o *object) reset() {
+	o.pos, o.vel = o.home, mgl.Vec3{}
+}
+
+// step slows the object down by floor friction and lets it fall to the floor.
+func (o *object) step(dt float64, w *World) {
+	world := w.profile.World
+	g := -world.Gravity[2]
+	bottom := o.pos[2] - o.size[2]/2
+	h, _, ok := w.ground.floor(o.pos[0], o.pos[1], bottom+maxStep)
+	if !ok || bottom > h+1e-3 {
+		o.vel[2] -= g * dt
+	} else {
+		o.pos[2], o.vel[2] = h+o.size[2]/2, 0
+		if s := o.vel.Len(); s > 0 {
+			o.vel = o.vel.Mul(math.Max(0, s-world.Mu*w.grip()*g*dt) / s)
+		}
+	}
+	o.pos = o.pos.Add(o.vel.Mul(dt))
+}
+
+func (o *object) output() *protocol.Object {
+	return &protocol.Object{
+		Name:  o.name,
+		Shape: o.shape,
+		Size:  o.size,
+		Body: protocol.Attitude{
+			Position:   []float64{o.pos[0], o.pos[1], o.pos[2]},
+			Quaternion: o.rot,
+		},
+	}
+}
@@ -0,0 +1,140 @@
+package simple
+
+import (
+	"fmt"
+	"math"
+
+	mgl "github.com/go-gl/mathgl/mgl64"
+
+	"github.com/nobonobo/rccargo/protocol"
+)
+
+// sides of the prisms and spheres standing in for cylinders and spheres.
+const sides = 16
+
+// plane is an infinite track plane, n pointing up: n.p = d.
+type plane struct {
+	n mgl.Vec3
+	d float64
+}
+
+// height returns the height of the plane at x, y.
+func (p *plane) height(x, y float64) (float64, bool) {
+	if p.n[2] < 1e-9 {
+		return 0, false // vertical
+	}
+	return (p.d - p.n[0]*x - p.n[1]*y) / p.n[2], true
+}
+
+// mesh builds triangles in body coordinates.
+type mesh struct {
+	vertices []mgl.Vec3
+	index    []uint32
+}
+
+func (m *mesh) vertex(x, y, z float64) uint32 {
+	m.vertices = append(m.vertices, mgl.Vec3{x, y, z})
+	return uint32(len(m.vertices) - 1)
+}
+
+func (m *mesh) quad(a, b, c, d uint32) {
+	m.index = append(m.index, a, b, c, a, c, d)
+}
+
+func boxMesh(size []float64) *mesh {
+	m := &mesh{}
+	for i := 0; i < 8; i++ {
+		x, y, z := size[0]/2, size[1]/2, size[2]/2
+		if i&1 == 0 {
+			x = -x
+		}
+		if i&2 == 0 {
+			y = -y
+		}
+		if i&4 == 0 {
+			z = -z
+		}
+		m.vertex(x, y, z)
+	}
+	m.quad(0, 1, 3, 2)
+	m.quad(4, 5, 7, 6)
+	m.quad(0, 2, 6, 4)
+	m.quad(1, 3, 7, 5)
+	m.quad(0, 1, 5, 4)
+	m.quad(2, 3, 7, 6)
+	return m
+}
+
+// cylinderMesh is a prism along z.
+func cylinderMesh(r, l float64) *mesh {
+	m := &mesh{}
+	bottom, top := m.vertex(0, 0, -l/2), m.vertex(0, 0, l/2)
+	for k := 0; k < sides; k++ {
+		a := 2 * math.Pi * float64(k) / sides
+		m.vertex(r*math.Cos(a), r*math.Sin(a), -l/2)
+		m.vertex(r*math.Cos(a), r*math.Sin(a), l/2)
+	}
+	for k := 0; k < sides; k++ {
+		b0, t0 := uint32(2+2*k), uint32(3+2*k)
+		b1, t1 := uint32(2+2*((k+1)%sides)), uint32(3+2*((k+1)%sides))
+		m.quad(b0, b1, t1, t0)
+		m.index = append(m.index, bottom, b1, b0, top, t0, t1)
+	}
+	return m
+}
+
+// sphereMesh is a UV sphere; the degenerate triangles at the poles are
+// dropped by ground.add.
+func sphereMesh(r float64) *mesh {
+	m := &mesh{}
+	rings := sides / 2
+	for j := 0; j <= rings; j++ {
+		phi := math.Pi * (float64(j)/float64(rings) - 0.5)
+		for k := 0; k < sides; k++ {
+			a := 2 * math.Pi * float64(k) / sides
+			m.vertex(r*math.Cos(phi)*math.Cos(a), r*math.Cos(phi)*math.Sin(a), r*math.Sin(phi))
+		}
+	}
+	for j := 0; j < rings; j++ {
+		for k := 0; k < sides; k++ {
+			a, b := uint32(j*sides+k), uint32(j*sides+(k+1)%sides)
+			m.quad(a, b, b+sides, a+sides)
+		}
+	}
+	return m
+}
+
+// AddPrimitive adds static track geometry as triangles, planes as they are.
+func (w *World) AddPrimitive(name, shape string, body protocol.Attitude, size []float64) error {
+	p, q := body.Position, body.Quaternion
+	pos, rot := mgl.Vec3{p[0], p[1], p[2]}, mgl.Quat{W: q[0], V: mgl.Vec3{q[1], q[2], q[3]}}
+	var m *mesh
+	switch shape {
+	case "box":
+		m = boxMesh(size)
+	case "cylinder":
+		m = cylinderMesh((size[0]+size[1])/4, size[2])
+	case "sphere":
+		m = sphereMesh((size[0] + size[1] + size[2]) / 6)
+	case "plane":
+		n := rot.Rotate(up)
+		if n[2] < 0 {
+			n = n.Mul(-1)
+		}
+		w.Lock()
+		defer w.Unlock()
+		w.ground.planes = append(w.ground.planes, plane{n, n.Dot(pos)})
+		return nil
+	default:
+		return fmt.Errorf("%s: unknown shape %q", name, shape)
+	}
+	vertices := make([]float64, 0, len(m.vertices)*3)
+	for _, v := range m.vertices {
+		v = rot.Rotate(v).Add(pos)
+		vertices = append(vertices, v[0], v[1], v[2])
+	}
+	w.Lock()
+	defer w.Unlock()
+	w.ground.add(vertices, m.index)
+	return nil
+}
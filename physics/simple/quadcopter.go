@@ -0,0 +1,206 @@
+package simple
+
+import (
+	"math"
+	"math/rand"
+
+	mgl "github.com/go-gl/mathgl/mgl64"
+
+	"github.com/nobonobo/rccargo/physics"
+	"github.com/nobonobo/rccargo/protocol"
+)
+
+// Quadcopter is a rigid frame lifted by four rotors, flown by the same
+// flight controller as in the ode backend. It lands on the floor flat and
+// without friction; nothing else but other crafts and objects touches it.
+type Quadcopter struct {
+	hull
+	world    *World
+	profile  protocol.QuadcopterProfile
+	in       protocol.Input
+	quat     mgl.Quat
+	omega    mgl.Vec3 // rad/s in frame coordinates
+	thrust   [4]float64
+	spin     [4]float64 // rad, for rendering
+	sleeping bool
+	idle     int // steps at rest
+}
+
+func newQuadcopter(w *World, profile protocol.QuadcopterProfile, pos []float64) *Quadcopter {
+	q := &Quadcopter{world: w, profile: profile, quat: mgl.QuatIdent()}
+	q.pos = mgl.Vec3{pos[0], pos[1], pos[2]}
+	q.sensors = physics.NewSensors(w.profile.Sensors, rand.Int63())
+	q.radio = physics.NewRadio(w.profile.Radio, w.profile.Failsafe, rand.Int63())
+	return q
+}
+
+// Kind ...
+func (q *Quadcopter) Kind() string {
+	return protocol.KindQuadcopter
+}
+
+func (q *Quadcopter) mass() float64 {
+	b := q.profile.FrameBox
+	return q.profile.Density * b[0] * b[1] * b[2]
+}
+
+// inertia returns the moments of inertia around the frame axes.
+func (q *Quadcopter) inertia() mgl.Vec3 {
+	b, m := q.profile.FrameBox, q.mass()
+	return mgl.Vec3{
+		m * (b[1]*b[1] + b[2]*b[2]) / 12,
+		m * (b[0]*b[0] + b[2]*b[2]) / 12,
+		m * (b[0]*b[0] + b[1]*b[1]) / 12,
+	}
+}
+
+func (q *Quadcopter) size() float64 {
+	b := q.profile.FrameBox
+	return math.Max(b[0], b[1])/2 + q.profile.RotorDiameter/2
+}
+
+// Set sends in over the radio.
+func (q *Quadcopter) Set(in *protocol.Input) {
+	if in, ok := q.radio.Send(*in); ok {
+		q.apply(&in)
+	}
+}
+
+func (q *Quadcopter) apply(in *protocol.Input) {
+	q.in = protocol.Input{
+		Steering: in.Steering,
+		Accel:    in.Accel,
+		Brake:    in.Brake,
+		Pitch:    in.Pitch,
+		Roll:     in.Roll,
+	}
+	if q.in != (protocol.Input{}) {
+		q.wake()
+	}
+}
+
+// Input ...
+func (q *Quadcopter) Input() protocol.Input {
+	return q.in
+}
+
+// Profile is zero: a quadcopter has no car setup.
+func (q *Quadcopter) Profile() protocol.VehicleProfile {
+	return protocol.VehicleProfile{}
+}
+
+// Sleeping ...
+func (q *Quadcopter) Sleeping() bool {
+	return q.sleeping
+}
+
+func (q *Quadcopter) wake() {
+	q.sleeping = false
+	q.idle = 0
+}
+
+// Attitude ...
+func (q *Quadcopter) Attitude() protocol.Attitude {
+	return protocol.Attitude{
+		Position:   []float64{q.pos[0], q.pos[1], q.pos[2]},
+		Quaternion: []float64{q.quat.W, q.quat.V[0], q.quat.V[1], q.quat.V[2]},
+	}
+}
+
+// Parts returns the rotor attitudes, rotor axis along the frame z axis.
+func (q *Quadcopter) Parts() []protocol.Attitude {
+	rs := make([]protocol.Attitude, len(q.thrust))
+	for i := range rs {
+		o := physics.RotorOffset(q.profile, i)
+		p := q.pos.Add(q.quat.Rotate(mgl.Vec3{o[0], o[1], o[2]}))
+		r := q.quat.Mul(mgl.QuatRotate(q.spin[i], up))
+		rs[i] = protocol.Attitude{
+			Position:   []float64{p[0], p[1], p[2]},
+			Quaternion: []float64{r.W, r.V[0], r.V[1], r.V[2]},
+		}
+	}
+	return rs
+}
+
+// Telemetry ...
+func (q *Quadcopter) Telemetry() *protocol.Telemetry {
+	w := q.quat.Rotate(q.omega)
+	return &protocol.Telemetry{
+		LinearVelocity:  []float64{q.vel[0], q.vel[1], q.vel[2]},
+		AngularVelocity: []float64{w[0], w[1], w[2]},
+		Wheels:          []protocol.WheelTelemetry{},
+		Rotors:          append([]float64(nil), q.thrust[:]...),
+		Signal:          q.radio.Signal(),
+	}
+}
+
+func (q *Quadcopter) sense(now, dt float64) {
+	m := q.motion(now, q.quat, q.quat.Rotate(q.omega), q.world.profile.World.Gravity, nil)
+	q.sensors.Step(m, dt)
+}
+
+// step runs the flight controller and integrates the frame by dt.
+func (q *Quadcopter) step(dt float64, g *ground) {
+	if q.sleeping {
+		return
+	}
+	world := q.world.profile.World
+	gravity := mgl.Vec3{world.Gravity[0], world.Gravity[1], world.Gravity[2]}
+	m, in := q.mass(), q.inertia()
+	u := q.quat.Inverse().Rotate(up)
+	s := physics.FlightState{
+		Up:      [3]float64{u[0], u[1], u[2]},
+		Omega:   [3]float64{q.omega[0], q.omega[1], q.omega[2]},
+		Climb:   q.vel[2],
+		Mass:    m,
+		Inertia: [3]float64{in[0], in[1], in[2]},
+		Gravity: -gravity[2],
+	}
+	max := physics.MaxRotorThrust(q.profile, m, s.Gravity)
+	q.thrust = physics.RotorThrust(q.profile, q.in, s)
+	lift, torque := 0.0, mgl.Vec3{}
+	for i, t := range q.thrust {
+		o := physics.RotorOffset(q.profile, i)
+		torque = torque.Add(mgl.Vec3{o[1] * t, -o[0] * t, physics.RotorSpin[i] * q.profile.TorqueRatio * t})
+		lift += t
+		q.spin[i] += physics.RotorRate(i, t, max) * dt
+	}
+	for j := range q.omega {
+		q.omega[j] += torque[j] / in[j] * dt
+	}
+	if w := q.omega.Len(); w > 0 {
+		q.quat = q.quat.Mul(mgl.QuatRotate(w*dt, q.omega.Mul(1/w))).Normalize()
+	}
+	q.vel = q.vel.Add(q.quat.Rotate(up.Mul(lift / m)).Add(gravity).Mul(dt))
+
+	next := q.pos.Add(q.vel.Mul(dt))
+	half := q.profile.FrameBox[2] / 2
+	bottom := next[2] - half
+	if g.blocked(next[0], next[1], bottom+maxStep, next[2]+half) {
+		next[0], next[1] = q.pos[0], q.pos[1]
+		q.vel[0], q.vel[1] = 0, 0
+	}
+	if h, n, ok := g.floor(next[0], next[1], bottom+maxStep); ok && bottom <= h {
+		next[2] = h + half
+		if d := q.vel.Dot(n); d < 0 {
+			q.vel = q.vel.Sub(n.Mul(d))
+		}
+	}
+	q.pos = next
+	q.rest(world)
+}
+
+// rest puts the quadcopter to sleep like ode auto-disable.
+func (q *Quadcopter) rest(world protocol.WorldProfile) {
+	if !world.AutoDisable || q.in != (protocol.Input{}) ||
+		q.vel.Len() > world.AutoDisableLinearThreshold ||
+		q.omega.Len() > world.AutoDisableAngularThreshold {
+		q.idle = 0
+		return
+	}
+	q.idle++
+	if q.idle >= world.AutoDisableSteps {
+		q.sleeping = true
+		q.vel, q.omega = mgl.Vec3{}, mgl.Vec3{}
+	}
+}
@@ -0,0 +1,306 @@
+package simple
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nobonobo/rccargo/physics"
+	"github.com/nobonobo/rccargo/protocol"
+)
+
+func newTestWorld(t *testing.T) physics.World {
+	profile := protocol.DefaultProfile()
+	profile.World.Mu = 1.0
+	profile.Vehicle.BodyBox = []float64{0.150, 0.380, 0.050}
+	profile.Failsafe.Timeout = 0 // inputs are set once, not streamed
+	w, err := physics.New("simple", profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a 10m square floor at z = 0
+	w.AddTriMesh([]float64{
+		-5, -5, 0,
+		5, -5, 0,
+		5, 5, 0,
+		-5, 5, 0,
+	}, []uint32{0, 1, 2, 0, 2, 3})
+	return w
+}
+
+func add(t *testing.T, w physics.World, name, kind string, pos []float64) physics.Vehicle {
+	v, err := w.AddVehicle(name, kind, pos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func run(w physics.World, n int) {
+	for i := 0; i < n; i++ {
+		w.Iter(10 * time.Millisecond)
+	}
+}
+
+func TestDrive(t *testing.T) {
+	w := newTestWorld(t)
+	v := add(t, w, "test", protocol.KindCar, []float64{0, 0, 0.2})
+	run(w, 100)
+	z := v.Attitude().Position[2]
+	if want := 0.088/2 + 0.025; z < want-1e-6 || z > want+1e-6 {
+		t.Fatalf("not on the floor: z = %v, want %v", z, want)
+	}
+	v.Set(&protocol.Input{Accel: 1.0})
+	run(w, 100)
+	if y := v.Attitude().Position[1]; y <= 0.01 {
+		t.Fatalf("did not drive forward: y = %v", y)
+	}
+	if len(v.Parts()) != 4 {
+		t.Fatalf("parts: %d", len(v.Parts()))
+	}
+}
+
+func TestSleep(t *testing.T) {
+	w := newTestWorld(t)
+	v := add(t, w, "test", protocol.KindCar, []float64{0, 0, 0.1})
+	run(w, 200)
+	if !v.Sleeping() {
+		t.Fatal("idle vehicle did not fall asleep")
+	}
+	v.Set(&protocol.Input{Accel: 0.5})
+	if v.Sleeping() {
+		t.Fatal("input did not wake the vehicle")
+	}
+}
+
+func TestCollide(t *testing.T) {
+	w := newTestWorld(t)
+	a := add(t, w, "a", protocol.KindCar, []float64{0, 0, 0.1})
+	b := add(t, w, "b", protocol.KindCar, []float64{0, 0.1, 0.1})
+	run(w, 10)
+	d := b.Attitude().Position[1] - a.Attitude().Position[1]
+	if d < 0.3 {
+		t.Fatalf("cars overlap: %v apart", d)
+	}
+	if w.GetVehicle("c") != nil {
+		t.Fatal("unknown vehicle is not nil")
+	}
+}
+
+func TestSteer(t *testing.T) {
+	w := newTestWorld(t)
+	v := add(t, w, "test", protocol.KindCar, []float64{0, 0, 0.1})
+	v.Set(&protocol.Input{Accel: 1.0, Steering: 1.0})
+	run(w, 100)
+	if x := v.Attitude().Position[0]; x <= 0 {
+		t.Fatalf("did not turn right: x = %v", x)
+	}
+}
+
+func TestQuadcopter(t *testing.T) {
+	w := newTestWorld(t)
+	q := add(t, w, "drone", protocol.KindQuadcopter, []float64{0, 0, 0.1})
+	run(w, 100)
+	z := q.Attitude().Position[2]
+	q.Set(&protocol.Input{Accel: 1.0})
+	run(w, 100)
+	if dz := q.Attitude().Position[2] - z; dz < 0.5 {
+		t.Fatalf("did not climb: %v", dz)
+	}
+	q.Set(&protocol.Input{Pitch: 1.0, Roll: 0.5})
+	run(w, 100)
+	if p := q.Attitude().Position; p[1] < 0.2 || p[0] < 0.05 {
+		t.Fatalf("did not fly forward and right: %v", p)
+	}
+	if tm := q.Telemetry(); len(tm.Rotors) != 4 || len(q.Parts()) != 4 {
+		t.Fatalf("rotors: %v", tm.Rotors)
+	}
+	if _, err := w.AddVehicle("x", "boat", []float64{0, 0, 0}); err == nil {
+		t.Fatal("unknown kind accepted")
+	}
+}
+
+func TestSensors(t *testing.T) {
+	w := newTestWorld(t)
+	v := add(t, w, "test", protocol.KindCar, []float64{0, 0, 0.1})
+	run(w, 100)
+	s := v.Sensors()
+	if len(s.IMU) != 100 || len(s.GPS) == 0 {
+		t.Fatalf("readings: %d imu, %d gps", len(s.IMU), len(s.GPS))
+	}
+	if a := s.IMU[len(s.IMU)-1].Accel[2]; a < 9 || a > 10.5 {
+		t.Fatalf("accel z at rest: %v", a)
+	}
+	if s := v.Sensors(); len(s.IMU) != 0 {
+		t.Fatalf("not drained: %d", len(s.IMU))
+	}
+	v.Set(&protocol.Input{Accel: 1.0})
+	run(w, 50)
+	s = v.Sensors()
+	if n := s.IMU[len(s.IMU)-1].Encoders[0]; n <= 0 {
+		t.Fatalf("encoder did not count forward: %d", n)
+	}
+}
+
+func TestRadio(t *testing.T) {
+	w := newTestWorld(t)
+	p := w.GetProfile()
+	p.Radio = protocol.RadioProfile{Range: 3, Fade: 1, Obstruction: 0.5, Latency: 0.05, MaxLatency: 0.05}
+	w.ApplyProfile(p)
+	w.SetDriverStand([]float64{0, 0, 1.6})
+	// a wall between the stand and the south side
+	w.AddTriMesh([]float64{
+		-1, -1.5, 0,
+		1, -1.5, 0,
+		0, -1.5, 3,
+	}, []uint32{0, 1, 2})
+	near := add(t, w, "near", protocol.KindCar, []float64{0, 1, 0.1})
+	far := add(t, w, "far", protocol.KindCar, []float64{0, 4.5, 0.1})
+	hidden := add(t, w, "hidden", protocol.KindCar, []float64{0, -1.8, 0.1})
+	run(w, 1)
+	for v, want := range map[physics.Vehicle]float64{near: 1, far: 0, hidden: 0.5} {
+		if s := v.Telemetry().Signal; s != want {
+			t.Errorf("signal: %v, want %v", s, want)
+		}
+	}
+	near.Set(&protocol.Input{Accel: 1})
+	far.Set(&protocol.Input{Accel: 1})
+	run(w, 2)
+	if in := near.Input(); in.Accel != 0 {
+		t.Fatalf("arrived before the latency: %+v", in)
+	}
+	run(w, 5)
+	if in := near.Input(); in.Accel != 1 {
+		t.Fatalf("not arrived: %+v", in)
+	}
+	if in := far.Input(); in.Accel != 0 {
+		t.Fatalf("arrived out of range: %+v", in)
+	}
+}
+
+func TestFailsafe(t *testing.T) {
+	w := newTestWorld(t)
+	p := w.GetProfile()
+	p.Failsafe.Timeout = 0.5
+	w.ApplyProfile(p)
+	v := add(t, w, "test", protocol.KindCar, []float64{0, 0, 0.2})
+	v.Set(&protocol.Input{Accel: 1})
+	run(w, 40)
+	if in := v.Input(); in.Accel != 1 || v.SignalLost() {
+		t.Fatalf("failsafe before the timeout: %+v", in)
+	}
+	run(w, 20)
+	if in := v.Input(); in.Accel != 0 || in.Brake != 1 || !v.SignalLost() {
+		t.Fatalf("no failsafe after the timeout: %+v", in)
+	}
+	v.Set(&protocol.Input{Accel: 0.5})
+	if in := v.Input(); in.Accel != 0.5 || v.SignalLost() {
+		t.Fatalf("input did not take over again: %+v", in)
+	}
+}
+
+func TestKinematic(t *testing.T) {
+	w := newTestWorld(t)
+	// a 1m square lift rising 0.1m per second
+	err := w.AddKinematic("lift", []float64{
+		-0.5, -0.5, 0,
+		0.5, -0.5, 0,
+		0.5, 0.5, 0,
+		-0.5, 0.5, 0,
+	}, []uint32{0, 1, 2, 0, 2, 3}, func(t float64) protocol.Attitude {
+		return protocol.Attitude{Position: []float64{0, 0, 0.1 * t}, Quaternion: []float64{1, 0, 0, 0}}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := add(t, w, "test", protocol.KindCar, []float64{0, 0, 0.2})
+	run(w, 100)
+	if z, want := v.Attitude().Position[2], 0.1+0.088/2+0.025; z < want-0.01 {
+		t.Fatalf("not lifted: z = %v, want %v", z, want)
+	}
+	n := 0
+	w.IterKinematics(func(k *protocol.Kinematic) {
+		n++
+	})
+	if n != 1 {
+		t.Fatalf("kinematics: %d", n)
+	}
+}
+
+func TestPrimitive(t *testing.T) {
+	w := newTestWorld(t)
+	// a 1m square box 0.1m high standing on the floor
+	box := protocol.Attitude{Position: []float64{0, 0, 0.05}, Quaternion: []float64{1, 0, 0, 0}}
+	if err := w.AddPrimitive("step", "box", box, []float64{1, 1, 0.1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.AddPrimitive("blob", "torus", box, []float64{1, 1, 1}); err == nil {
+		t.Fatal("unknown shape accepted")
+	}
+	v := add(t, w, "test", protocol.KindCar, []float64{0, 0, 0.3})
+	run(w, 100)
+	if z, want := v.Attitude().Position[2], 0.1+0.088/2+0.025; z < want-1e-6 || z > want+1e-6 {
+		t.Fatalf("not on the box: z = %v, want %v", z, want)
+	}
+}
+
+func TestSetVehicleProfile(t *testing.T) {
+	w := newTestWorld(t)
+	v := add(t, w, "test", protocol.KindCar, []float64{0, 0, 0.2})
+	profile := w.GetProfile().Vehicle
+	profile.FinalDrive = 2
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			w.SetVehicleProfile("test", profile)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		v.Profile()
+	}
+	<-done
+	if got := v.Profile().FinalDrive; got != 2 {
+		t.Fatalf("final drive: %v", got)
+	}
+}
+
+func TestApplyProfile(t *testing.T) {
+	w := newTestWorld(t)
+	v := add(t, w, "test", protocol.KindCar, []float64{0, 0, 0.2})
+	profile := w.GetProfile()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			profile.Vehicle.FinalDrive = float64(i%2 + 1)
+			w.ApplyProfile(profile)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		v.Profile()
+	}
+	<-done
+	if got := v.Profile().FinalDrive; got != 2 {
+		t.Fatalf("final drive: %v", got)
+	}
+}
+
+func TestApplyProfileTuned(t *testing.T) {
+	w := newTestWorld(t)
+	v := add(t, w, "test", protocol.KindCar, []float64{0, 0, 0.2})
+	profile := w.GetProfile()
+	profile.Tune.Min.FinalDrive, profile.Tune.Max.FinalDrive = 0.5, 2
+	w.ApplyProfile(profile)
+	setup := profile.Vehicle
+	setup.FinalDrive = 1.5
+	w.SetVehicleProfile("test", setup)
+	w.ApplyProfile(profile)
+	if got := v.Profile().FinalDrive; got != 1.5 {
+		t.Fatalf("tuned setup within the limits reset: %v", got)
+	}
+	profile.Tune.Max.FinalDrive = 1.2
+	w.ApplyProfile(profile)
+	if got, want := v.Profile().FinalDrive, profile.Vehicle.FinalDrive; got != want {
+		t.Fatalf("setup out of the new limits kept: %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,324 @@
+package simple
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+
+	mgl "github.com/go-gl/mathgl/mgl64"
+
+	"github.com/nobonobo/rccargo/physics"
+	"github.com/nobonobo/rccargo/protocol"
+)
+
+// maxStep is the highest ledge in m a car drives up without stopping.
+const maxStep = 0.02
+
+// wheelRest is the rotation of a wheel relative to the chassis: cylinder
+// axis along the chassis x axis, the same as in the ode backend.
+var wheelRest = mgl.Quat{W: 0.5, V: mgl.Vec3{-0.5, 0.5, -0.5}}
+
+type motor struct {
+	vel  float64 // 動輪目標速度rad/s
+	fmax float64 // 動輪トルク最大値Nm
+}
+
+type wheel struct {
+	motor   motor
+	omega   float64 // rad/s, positive rolling forward
+	spin    float64 // rad, for rendering
+	load    float64 // N
+	ratio   float64
+	angle   float64 // rad
+	contact bool
+}
+
+// Vehicle is a car: a rigid chassis moving on the track floor with one
+// tire force per corner. Suspension, tire wear and damage are not modelled.
+type Vehicle struct {
+	hull
+	world    *World
+	setup    sync.Mutex // guards profile against Profile; writers hold the world lock too
+	profile  protocol.VehicleProfile
+	in       protocol.Input
+	yaw      float64 // rad around z, 0: forward is +y
+	yawRate  float64
+	tilt     mgl.Quat // floor alignment
+	steer    float64  // rad, hinge2 Angle1: positive turns left
+	wheels   [4]wheel
+	grounded bool
+	sleeping bool
+	idle     int // steps at rest
+}
+
+func newVehicle(w *World, profile protocol.VehicleProfile, pos []float64) *Vehicle {
+	v := &Vehicle{world: w, profile: profile, tilt: mgl.QuatIdent()}
+	v.pos = mgl.Vec3{pos[0], pos[1], pos[2]}
+	v.sensors = physics.NewSensors(w.profile.Sensors, rand.Int63())
+	v.radio = physics.NewRadio(w.profile.Radio, w.profile.Failsafe, rand.Int63())
+	v.apply(&protocol.Input{})
+	return v
+}
+
+// Kind ...
+func (v *Vehicle) Kind() string {
+	return protocol.KindCar
+}
+
+func (v *Vehicle) radius() float64 {
+	return v.profile.TireDiameter / 2
+}
+
+// rideHeight is the chassis center above the floor.
+func (v *Vehicle) rideHeight() float64 {
+	return v.radius() + 0.025
+}
+
+func (v *Vehicle) mass() float64 {
+	b := v.profile.BodyBox
+	r := v.radius()
+	tire := v.profile.TireDensity * math.Pi * r * r * v.profile.TireWidth
+	return v.profile.BodyDensity*b[0]*b[1]*b[2] + 4*tire
+}
+
+// inertia is the moment of inertia around z.
+func (v *Vehicle) inertia() float64 {
+	return v.mass() * (v.profile.Wheelbase*v.profile.Wheelbase + v.profile.Tread*v.profile.Tread) / 12
+}
+
+// size is the radius of the circle used against other cars and objects.
+func (v *Vehicle) size() float64 {
+	b := v.profile.BodyBox
+	return math.Max(b[0], b[1]) / 2
+}
+
+// corner returns the wheel center of corner i relative to the chassis.
+func (v *Vehicle) corner(i int) mgl.Vec3 {
+	lr := 1.0
+	if i%2 == 0 {
+		lr = -1.0
+	}
+	fr := -1.0
+	if i/2 == 0 {
+		fr = 1.0
+	}
+	return mgl.Vec3{lr * v.profile.Tread / 2, fr * v.profile.Wheelbase / 2, -0.025}
+}
+
+func (v *Vehicle) quat() mgl.Quat {
+	return v.tilt.Mul(mgl.QuatRotate(v.yaw, up))
+}
+
+// Set sends in over the radio.
+func (v *Vehicle) Set(in *protocol.Input) {
+	if in, ok := v.radio.Send(*in); ok {
+		v.apply(&in)
+	}
+}
+
+func (v *Vehicle) apply(in *protocol.Input) {
+	if in.Steering != 0 || in.Accel != 0 || in.Brake != 0 {
+		v.wake()
+	}
+	v.in = protocol.Input{Steering: in.Steering, Accel: in.Accel, Brake: in.Brake}
+	for i := range v.wheels {
+		if in.Brake > 0.5 {
+			brake := (in.Brake-0.5)*2 - in.Accel
+			v.wheels[i].motor = motor{0.0, brake * 1e-3}
+		} else {
+			factor := 0.55
+			if i < 2 {
+				factor = 0.45
+			}
+			v.wheels[i].motor = motor{160.0 * v.profile.FinalDrive, factor * in.Accel * 1e-3 / v.profile.FinalDrive}
+		}
+	}
+}
+
+// Input ...
+func (v *Vehicle) Input() protocol.Input {
+	return v.in
+}
+
+// Profile ...
+func (v *Vehicle) Profile() protocol.VehicleProfile {
+	v.setup.Lock()
+	defer v.setup.Unlock()
+	return v.profile
+}
+
+// Sleeping ...
+func (v *Vehicle) Sleeping() bool {
+	return v.sleeping
+}
+
+func (v *Vehicle) wake() {
+	v.sleeping = false
+	v.idle = 0
+}
+
+// Attitude ...
+func (v *Vehicle) Attitude() protocol.Attitude {
+	q := v.quat()
+	return protocol.Attitude{
+		Position:   []float64{v.pos[0], v.pos[1], v.pos[2]},
+		Quaternion: []float64{q.W, q.V[0], q.V[1], q.V[2]},
+	}
+}
+
+// Parts returns the wheel attitudes.
+func (v *Vehicle) Parts() []protocol.Attitude {
+	q := v.quat()
+	ts := make([]protocol.Attitude, len(v.wheels))
+	for i, w := range v.wheels {
+		p := v.pos.Add(q.Rotate(v.corner(i)))
+		steer := 0.0
+		if i < 2 {
+			steer = v.steer
+		}
+		wq := q.Mul(mgl.QuatRotate(steer, up)).
+			Mul(mgl.QuatRotate(-w.spin, mgl.Vec3{1, 0, 0})).
+			Mul(wheelRest)
+		ts[i] = protocol.Attitude{
+			Position:   []float64{p[0], p[1], p[2]},
+			Quaternion: []float64{wq.W, wq.V[0], wq.V[1], wq.V[2]},
+		}
+	}
+	return ts
+}
+
+// Telemetry ...
+func (v *Vehicle) Telemetry() *protocol.Telemetry {
+	t := &protocol.Telemetry{
+		LinearVelocity:  []float64{v.vel[0], v.vel[1], v.vel[2]},
+		AngularVelocity: []float64{0, 0, v.yawRate},
+		Wheels:          make([]protocol.WheelTelemetry, len(v.wheels)),
+		Damage:          protocol.Damage{Suspension: make([]float64, len(v.wheels))},
+	}
+	ambient := v.world.profile.World.AmbientTemp
+	for i, w := range v.wheels {
+		t.Wheels[i] = protocol.WheelTelemetry{
+			Contact:         w.contact,
+			SlipRatio:       w.ratio,
+			SlipAngle:       w.angle,
+			Load:            w.load,
+			AngularVelocity: w.omega,
+			Temperature:     ambient,
+		}
+	}
+	t.Signal = v.radio.Signal()
+	return t
+}
+
+func (v *Vehicle) sense(now, dt float64) {
+	wheels := make([]float64, len(v.wheels))
+	for i, w := range v.wheels {
+		wheels[i] = w.omega
+	}
+	m := v.motion(now, v.quat(), mgl.Vec3{0, 0, v.yawRate}, v.world.profile.World.Gravity, wheels)
+	v.sensors.Step(m, dt)
+}
+
+// step advances the vehicle by dt on the floor of g.
+func (v *Vehicle) step(dt float64, g *ground) {
+	if v.sleeping {
+		return
+	}
+	// 操舵: the same servo rate as the ode model, limited to 1 rad
+	d := -v.in.Steering/3.0 - v.steer
+	v.steer = math.Max(-1.0, math.Min(1.0, v.steer+d*8*dt*1e3*dt))
+
+	world := v.world.profile.World
+	gravity := mgl.Vec3{world.Gravity[0], world.Gravity[1], world.Gravity[2]}
+	bottom := v.pos[2] - v.rideHeight()
+	h, n, ok := g.floor(v.pos[0], v.pos[1], bottom+maxStep)
+	v.grounded = ok && bottom <= h+1e-3
+	for i := range v.wheels {
+		v.wheels[i].contact = v.grounded
+		v.wheels[i].load, v.wheels[i].ratio, v.wheels[i].angle = 0, 0, 0
+	}
+	if !v.grounded {
+		v.vel = v.vel.Add(gravity.Mul(dt))
+		v.move(dt, g)
+		return
+	}
+	m, iz, r := v.mass(), v.inertia(), v.radius()
+	fwd := mgl.Vec3{-math.Sin(v.yaw), math.Cos(v.yaw), 0}
+	right := mgl.Vec3{math.Cos(v.yaw), math.Sin(v.yaw), 0}
+	mu := world.Mu * v.profile.Compound.Grip * v.world.grip()
+	load := -gravity.Dot(n) * m / float64(len(v.wheels))
+	force, torque := mgl.Vec3{}, 0.0
+	for i := range v.wheels {
+		w := &v.wheels[i]
+		c := v.corner(i)
+		arm := right.Mul(c[0]).Add(fwd.Mul(c[1]))
+		vp := v.vel.Add(mgl.Vec3{-arm[1], arm[0], 0}.Mul(v.yawRate))
+		wf, ws := fwd, right
+		if i < 2 {
+			rot := mgl.QuatRotate(v.steer, up)
+			wf, ws = rot.Rotate(fwd), rot.Rotate(right)
+		}
+		vx, vy := vp.Dot(wf), vp.Dot(ws)
+		// the motor drives the wheel toward its target speed through the tire,
+		// the tire stops sideways sliding within one step; both share the grip
+		limit := w.motor.fmax / r
+		fx := math.Max(-limit, math.Min(limit, (w.motor.vel*r-vx)*m/4/dt))
+		cs := arm[0]*ws[1] - arm[1]*ws[0]
+		fy := -vy / dt / (4 * (1/m + cs*cs/iz))
+		surface := vx
+		if l, grip := math.Hypot(fx, fy), mu*load; l > grip {
+			fx, fy = fx*grip/l, fy*grip/l
+			surface = w.motor.vel * r // spinning or locked
+		}
+		f := wf.Mul(fx).Add(ws.Mul(fy))
+		force = force.Add(f)
+		torque += arm[0]*f[1] - arm[1]*f[0]
+		w.omega = surface / r
+		w.load = load
+		w.ratio = (surface - vx) / math.Max(math.Abs(vx), 0.1)
+		w.angle = math.Atan2(vy, math.Abs(vx))
+	}
+	// gravity along the slope, the floor carries the rest
+	slope := gravity.Sub(n.Mul(gravity.Dot(n)))
+	v.vel = v.vel.Add(force.Mul(dt / m)).Add(slope.Mul(dt))
+	v.yawRate += torque / iz * dt
+	v.move(dt, g)
+	v.tilt = mgl.QuatBetweenVectors(up, n)
+	v.rest(world)
+}
+
+// move integrates the pose and keeps the car on the floor and out of walls.
+func (v *Vehicle) move(dt float64, g *ground) {
+	for i := range v.wheels {
+		v.wheels[i].spin += v.wheels[i].omega * dt
+	}
+	next := v.pos.Add(v.vel.Mul(dt))
+	v.yaw += v.yawRate * dt
+	bottom := next[2] - v.rideHeight()
+	if g.blocked(next[0], next[1], bottom+maxStep, next[2]+v.profile.BodyBox[2]/2) {
+		next[0], next[1] = v.pos[0], v.pos[1]
+		v.vel[0], v.vel[1] = 0, 0
+	}
+	if h, n, ok := g.floor(next[0], next[1], bottom+maxStep); ok && bottom <= h {
+		next[2] = h + v.rideHeight()
+		if d := v.vel.Dot(n); d < 0 {
+			v.vel = v.vel.Sub(n.Mul(d))
+		}
+	}
+	v.pos = next
+}
+
+// rest counts steps at rest and puts the car to sleep like ode auto-disable.
+func (v *Vehicle) rest(world protocol.WorldProfile) {
+	if !world.AutoDisable || v.in.Accel != 0 || v.in.Brake != 0 ||
+		v.vel.Len() > world.AutoDisableLinearThreshold ||
+		math.Abs(v.yawRate) > world.AutoDisableAngularThreshold {
+		v.idle = 0
+		return
+	}
+	v.idle++
+	if v.idle >= world.AutoDisableSteps {
+		v.sleeping = true
+		v.vel, v.yawRate = mgl.Vec3{}, 0
+	}
+}
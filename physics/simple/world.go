@@ -0,0 +1,494 @@
+// Package simple is a pure Go physics backend. Cars are rigid bodies
+// sliding on the floor of the track triangles with one tire force per
+// corner, quadcopters fly free of any contact but the floor, objects are
+// pucks. It needs no cgo and is good enough for bots,
+// tests and CI, not for racing.
+package simple
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"reflect"
+	"sync"
+	"time"
+
+	mgl "github.com/go-gl/mathgl/mgl64"
+
+	"github.com/nobonobo/rccargo/physics"
+	"github.com/nobonobo/rccargo/protocol"
+)
+
+func init() {
+	physics.Register("simple", func(profile protocol.Profile) physics.World {
+		return NewWorld(profile)
+	})
+}
+
+// maxStepsPerIter bounds catch-up work when running faster than real time.
+const maxStepsPerIter = 8
+
+// restitution of car and object impacts.
+const restitution = 0.2
+
+// craft is a vehicle of any kind in a World.
+type craft interface {
+	physics.Vehicle
+	step(dt float64, g *ground)
+	// apply takes an input that came through the radio.
+	apply(in *protocol.Input)
+	// sense samples the sensors after the step.
+	sense(now, dt float64)
+	body() *hull
+	size() float64
+	mass() float64
+	wake()
+}
+
+// hull is the state collisions between crafts and the sensors work on.
+type hull struct {
+	pos        mgl.Vec3
+	vel        mgl.Vec3
+	team       int
+	ghostUntil float64 // simulation time
+	sensors    *physics.Sensors
+	radio      *physics.Radio
+}
+
+func (h *hull) body() *hull {
+	return h
+}
+
+// SignalLost ...
+func (h *hull) SignalLost() bool {
+	return h.radio.Lost()
+}
+
+// Sensors ...
+func (h *hull) Sensors() *protocol.Sensors {
+	return h.sensors.Drain()
+}
+
+// motion returns the state for the sensors after a step.
+func (h *hull) motion(now float64, q mgl.Quat, angular mgl.Vec3, gravity []float64, wheels []float64) physics.Motion {
+	m := physics.Motion{
+		Time:            now,
+		Position:        h.pos,
+		Velocity:        h.vel,
+		AngularVelocity: angular,
+		Quaternion:      [4]float64{q.W, q.V[0], q.V[1], q.V[2]},
+		Wheels:          wheels,
+	}
+	copy(m.Gravity[:], gravity)
+	return m
+}
+
+// World ...
+type World struct {
+	sync.RWMutex
+	profile    protocol.Profile
+	ground     *ground
+	vehicles   map[string]craft
+	objects    []*object
+	kinematics []*kinematic
+	wetness    float64
+	paused     bool
+	pending    int
+	timeScale  float64
+	lag        time.Duration
+	time       float64 // simulated seconds
+	stand      *mgl.Vec3
+}
+
+var _ physics.World = (*World)(nil)
+
+// NewWorld ...
+func NewWorld(profile protocol.Profile) *World {
+	return &World{
+		profile:   profile,
+		ground:    newGround(),
+		vehicles:  map[string]craft{},
+		wetness:   profile.Track.Wetness,
+		timeScale: 1.0,
+	}
+}
+
+// Iter advances the simulation by one real-time tick of length step, in
+// fixed steps of that length like the ode backend.
+func (w *World) Iter(step time.Duration) {
+	w.Lock()
+	defer w.Unlock()
+	if w.paused {
+		if w.pending > 0 {
+			w.pending--
+			w.step(step)
+		}
+		return
+	}
+	w.lag += time.Duration(float64(step) * w.timeScale)
+	for n := 0; w.lag >= step; n++ {
+		if n == maxStepsPerIter {
+			w.lag = 0
+			break
+		}
+		w.lag -= step
+		w.step(step)
+	}
+}
+
+func (w *World) step(step time.Duration) {
+	dt := float64(step) / float64(time.Second)
+	w.time += dt
+	w.moveKinematics(w.time)
+	for _, v := range w.vehicles {
+		if in, ok := v.body().radio.Receive(w.time); ok {
+			v.apply(&in)
+		}
+		v.step(dt, w.ground)
+	}
+	for _, o := range w.objects {
+		o.step(dt, w)
+	}
+	w.collide()
+	for _, v := range w.vehicles {
+		v.sense(w.time, dt)
+		w.tune(v.body())
+	}
+}
+
+// tune sets the signal of h from its distance to the driver stand and the
+// line of sight.
+func (w *World) tune(h *hull) {
+	p := w.profile.Radio
+	q := 1.0
+	if w.stand != nil && p.Range > 0 {
+		q = physics.Signal(p, h.pos.Sub(*w.stand).Len(), w.ground.sight(*w.stand, h.pos))
+	}
+	h.radio.SetSignal(q)
+}
+
+// grip is the friction multiplier of the track surface.
+func (w *World) grip() float64 {
+	return 1 - w.wetness*(1-w.profile.Track.WetGrip)
+}
+
+// collides applies the collision mode of the profile to a pair of crafts.
+func (w *World) collides(a, b *hull) bool {
+	switch w.profile.Collision.Mode {
+	case "ghost":
+		return false
+	case "reset":
+		return w.time >= a.ghostUntil && w.time >= b.ghostUntil
+	case "team":
+		return a.team != b.team
+	}
+	return true
+}
+
+// collide separates overlapping crafts and objects, treating them as
+// circles seen from above.
+func (w *World) collide() {
+	vs := make([]craft, 0, len(w.vehicles))
+	for _, v := range w.vehicles {
+		vs = append(vs, v)
+	}
+	for i, a := range vs {
+		ha := a.body()
+		for _, b := range vs[i+1:] {
+			hb := b.body()
+			if w.collides(ha, hb) {
+				if bump(&ha.pos, &ha.vel, a.size(), a.mass(), &hb.pos, &hb.vel, b.size(), b.mass()) {
+					a.wake()
+					b.wake()
+				}
+			}
+		}
+		for _, o := range w.objects {
+			if bump(&ha.pos, &ha.vel, a.size(), a.mass(), &o.pos, &o.vel, o.radius, o.mass) {
+				a.wake()
+			}
+		}
+	}
+}
+
+// bump pushes two overlapping circles apart and exchanges momentum along
+// the line between their centers.
+func bump(pa, va *mgl.Vec3, ra, ma float64, pb, vb *mgl.Vec3, rb, mb float64) bool {
+	d := mgl.Vec3{pb[0] - pa[0], pb[1] - pa[1], 0}
+	dist := d.Len()
+	if dist >= ra+rb || dist == 0 || math.Abs(pb[2]-pa[2]) > ra+rb {
+		return false
+	}
+	n := d.Mul(1 / dist)
+	overlap := ra + rb - dist
+	*pa = pa.Sub(n.Mul(overlap * mb / (ma + mb)))
+	*pb = pb.Add(n.Mul(overlap * ma / (ma + mb)))
+	if vn := vb.Sub(*va).Dot(n); vn < 0 {
+		j := -(1 + restitution) * vn / (1/ma + 1/mb)
+		*va = va.Sub(n.Mul(j / ma))
+		*vb = vb.Add(n.Mul(j / mb))
+	}
+	return true
+}
+
+// GetProfile ...
+func (w *World) GetProfile() protocol.Profile {
+	w.RLock()
+	defer w.RUnlock()
+	return w.profile
+}
+
+// ApplyProfile switches to profile; cars still on the previous vehicle
+// profile take the new one, tuned cars keep their setup while the new tune
+// limits allow it. Quadcopters
+// always take the new quadcopter profile.
+func (w *World) ApplyProfile(profile protocol.Profile) {
+	w.Lock()
+	defer w.Unlock()
+	prev := w.profile.Vehicle
+	w.profile = profile
+	for name, v := range w.vehicles {
+		v.body().sensors.SetProfile(profile.Sensors)
+		v.body().radio.SetProfile(profile.Radio, profile.Failsafe)
+		switch v := v.(type) {
+		case *Vehicle:
+			v.setup.Lock()
+			if reflect.DeepEqual(v.profile, prev) {
+				v.profile = profile.Vehicle
+				v.apply(&v.in)
+			} else if err := profile.Tune.Check(profile.Vehicle, v.profile); err != nil {
+				log.Println("setup reset:", name, err)
+				v.profile = profile.Vehicle
+				v.apply(&v.in)
+			}
+			v.setup.Unlock()
+		case *Quadcopter:
+			v.profile = profile.Quadcopter
+		}
+	}
+}
+
+// AddTriMesh ...
+func (w *World) AddTriMesh(vertices []float64, index []uint32) {
+	w.Lock()
+	defer w.Unlock()
+	w.ground.add(vertices, index)
+}
+
+// SetDriverStand ...
+func (w *World) SetDriverStand(pos []float64) {
+	w.Lock()
+	defer w.Unlock()
+	if pos == nil {
+		w.stand = nil
+		return
+	}
+	w.stand = &mgl.Vec3{pos[0], pos[1], pos[2]}
+}
+
+// AddObject ...
+func (w *World) AddObject(name, kind string, body protocol.Attitude, size []float64) error {
+	w.Lock()
+	defer w.Unlock()
+	profile, ok := w.profile.Objects[kind]
+	if !ok {
+		return fmt.Errorf("%s: unknown object kind %q", name, kind)
+	}
+	o, err := newObject(name, profile, body, size)
+	if err != nil {
+		return err
+	}
+	w.objects = append(w.objects, o)
+	return nil
+}
+
+// ResetObjects ...
+func (w *World) ResetObjects() int {
+	w.Lock()
+	defer w.Unlock()
+	for _, o := range w.objects {
+		o.reset()
+	}
+	return len(w.objects)
+}
+
+// IterObjects ...
+func (w *World) IterObjects(f func(*protocol.Object)) {
+	w.RLock()
+	defer w.RUnlock()
+	for _, o := range w.objects {
+		f(o.output())
+	}
+}
+
+// newCraft creates a craft of kind at pos. The caller must hold the lock.
+func (w *World) newCraft(kind string, pos []float64) (craft, error) {
+	switch kind {
+	case "", protocol.KindCar:
+		return newVehicle(w, w.profile.Vehicle, pos), nil
+	case protocol.KindQuadcopter:
+		return newQuadcopter(w, w.profile.Quadcopter, pos), nil
+	}
+	return nil, fmt.Errorf("unknown vehicle kind: %s", kind)
+}
+
+// AddVehicle ...
+func (w *World) AddVehicle(name, kind string, pos []float64) (physics.Vehicle, error) {
+	w.Lock()
+	defer w.Unlock()
+	v, err := w.newCraft(kind, pos)
+	if err != nil {
+		return nil, err
+	}
+	v.body().ghostUntil = w.time + w.profile.Collision.GhostTime
+	w.vehicles[name] = v
+	return v, nil
+}
+
+// GetVehicle ...
+func (w *World) GetVehicle(name string) physics.Vehicle {
+	w.RLock()
+	defer w.RUnlock()
+	if v := w.vehicles[name]; v != nil {
+		return v
+	}
+	return nil
+}
+
+// RmVehicle ...
+func (w *World) RmVehicle(name string) {
+	w.Lock()
+	defer w.Unlock()
+	delete(w.vehicles, name)
+}
+
+// ResetVehicle ...
+func (w *World) ResetVehicle(name string, pos []float64) physics.Vehicle {
+	w.Lock()
+	defer w.Unlock()
+	old := w.vehicles[name]
+	if old == nil {
+		return nil
+	}
+	var v craft
+	switch old := old.(type) {
+	case *Vehicle:
+		v = newVehicle(w, old.profile, pos)
+	default:
+		v, _ = w.newCraft(old.Kind(), pos)
+	}
+	in := old.Input()
+	v.apply(&in)
+	v.body().team = old.body().team
+	v.body().sensors = old.body().sensors
+	v.body().radio = old.body().radio
+	v.body().ghostUntil = w.time + w.profile.Collision.GhostTime
+	w.vehicles[name] = v
+	return v
+}
+
+// SetVehicleProfile sets the setup of the named car. Other kinds are left
+// as they are.
+func (w *World) SetVehicleProfile(name string, profile protocol.VehicleProfile) physics.Vehicle {
+	w.Lock()
+	defer w.Unlock()
+	v := w.vehicles[name]
+	if v == nil {
+		return nil
+	}
+	if car, ok := v.(*Vehicle); ok {
+		car.setup.Lock()
+		car.profile = profile
+		car.setup.Unlock()
+		car.apply(&car.in)
+	}
+	return v
+}
+
+// IterVehicles ...
+func (w *World) IterVehicles(f func(string, physics.Vehicle)) {
+	w.Lock()
+	defer w.Unlock()
+	for name, v := range w.vehicles {
+		f(name, v)
+	}
+}
+
+// SetTeam ...
+func (w *World) SetTeam(name string, team int) error {
+	if team < 0 || team >= physics.MaxTeams {
+		return fmt.Errorf("team %d out of range [0, %d)", team, physics.MaxTeams)
+	}
+	w.Lock()
+	defer w.Unlock()
+	v := w.vehicles[name]
+	if v == nil {
+		return fmt.Errorf("unknown name: %s", name)
+	}
+	v.body().team = team
+	return nil
+}
+
+// SetWetness ...
+func (w *World) SetWetness(wetness float64) {
+	w.Lock()
+	defer w.Unlock()
+	w.wetness = math.Max(0, math.Min(1, wetness))
+}
+
+// Wetness ...
+func (w *World) Wetness() float64 {
+	w.RLock()
+	defer w.RUnlock()
+	return w.wetness
+}
+
+// Pause ...
+func (w *World) Pause() {
+	w.Lock()
+	defer w.Unlock()
+	w.paused = true
+	w.lag = 0
+}
+
+// Resume ...
+func (w *World) Resume() {
+	w.Lock()
+	defer w.Unlock()
+	w.paused = false
+	w.pending = 0
+}
+
+// Paused ...
+func (w *World) Paused() bool {
+	w.RLock()
+	defer w.RUnlock()
+	return w.paused
+}
+
+// StepOnce runs n fixed steps on the following ticks while paused.
+func (w *World) StepOnce(n int) {
+	w.Lock()
+	defer w.Unlock()
+	if w.paused && n > 0 {
+		w.pending += n
+	}
+}
+
+// SetTimeScale ...
+func (w *World) SetTimeScale(scale float64) error {
+	if scale <= 0 || scale > maxStepsPerIter {
+		return fmt.Errorf("time scale %v out of range (0, %d]", scale, maxStepsPerIter)
+	}
+	w.Lock()
+	defer w.Unlock()
+	w.timeScale = scale
+	return nil
+}
+
+// TimeScale ...
+func (w *World) TimeScale() float64 {
+	w.RLock()
+	defer w.RUnlock()
+	return w.timeScale
+}
@@ -0,0 +1,211 @@
+package protocol
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/rpc"
+)
+
+// maxMessage bounds the length of a binary message.
+const maxMessage = 1 << 20
+
+// Each binary message is its uvarint length and then the payload:
+// requests are seq, method and body; responses seq, method, error and
+// body. A body starts with a tag: Input and Output are in the binary
+// encoding, anything else JSON.
+const (
+	bodyJSON   = 'j'
+	bodyInput  = 'i'
+	bodyOutput = 'o'
+)
+
+type codec struct {
+	rwc io.ReadWriteCloser
+	r   *bufio.Reader
+	msg reader
+}
+
+// NewServerCodec returns a net/rpc server codec of the binary wire
+// format on rwc.
+func NewServerCodec(rwc io.ReadWriteCloser) rpc.ServerCodec {
+	return &codec{rwc: rwc, r: bufio.NewReader(rwc)}
+}
+
+// NewClientCodec returns a net/rpc client codec of the binary wire format
+// on rwc.
+func NewClientCodec(rwc io.ReadWriteCloser) rpc.ClientCodec {
+	return &codec{rwc: rwc, r: bufio.NewReader(rwc)}
+}
+
+func readFrame(r *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxMessage {
+		return nil, fmt.Errorf("protocol: message of %d bytes", n)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func frame(payload []byte) []byte {
+	msg := writer(make([]byte, 0, len(payload)+binary.MaxVarintLen64))
+	msg.uvarint(uint64(len(payload)))
+	return append(msg, payload...)
+}
+
+func (c *codec) read() error {
+	b, err := readFrame(c.r)
+	if err != nil {
+		return err
+	}
+	c.msg = reader{b: b}
+	return nil
+}
+
+// write sends the message in one Write, one websocket frame.
+func (c *codec) write(payload writer, body interface{}) error {
+	payload, err := appendBody(payload, body)
+	if err != nil {
+		return err
+	}
+	_, err = c.rwc.Write(frame(payload))
+	return err
+}
+
+// EncodeMessage returns body as a message of a push stream: framed like
+// the binary RPC codec, the payload is the body alone.
+func EncodeMessage(body interface{}) ([]byte, error) {
+	payload, err := appendBody(nil, body)
+	if err != nil {
+		return nil, err
+	}
+	return frame(payload), nil
+}
+
+// WriteMessage writes body to w as a message of a push stream in one
+// Write.
+func WriteMessage(w io.Writer, body interface{}) error {
+	b, err := EncodeMessage(body)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// MessageReader reads the messages of a push stream.
+type MessageReader struct {
+	r *bufio.Reader
+}
+
+// NewMessageReader ...
+func NewMessageReader(r io.Reader) *MessageReader {
+	return &MessageReader{r: bufio.NewReader(r)}
+}
+
+// Read decodes the next message into body.
+func (m *MessageReader) Read(body interface{}) error {
+	b, err := readFrame(m.r)
+	if err != nil {
+		return err
+	}
+	return decodeBody(b, body)
+}
+
+func (c *codec) ReadRequestHeader(r *rpc.Request) error {
+	if err := c.read(); err != nil {
+		return err
+	}
+	r.Seq = c.msg.uvarint()
+	r.ServiceMethod = c.msg.str()
+	return c.msg.err
+}
+
+func (c *codec) ReadRequestBody(body interface{}) error {
+	return decodeBody(c.msg.b, body)
+}
+
+func (c *codec) WriteResponse(r *rpc.Response, body interface{}) error {
+	var w writer
+	w.uvarint(r.Seq)
+	w.str(r.ServiceMethod)
+	w.str(r.Error)
+	return c.write(w, body)
+}
+
+func (c *codec) WriteRequest(r *rpc.Request, body interface{}) error {
+	var w writer
+	w.uvarint(r.Seq)
+	w.str(r.ServiceMethod)
+	return c.write(w, body)
+}
+
+func (c *codec) ReadResponseHeader(r *rpc.Response) error {
+	if err := c.read(); err != nil {
+		return err
+	}
+	r.Seq = c.msg.uvarint()
+	r.ServiceMethod = c.msg.str()
+	r.Error = c.msg.str()
+	return c.msg.err
+}
+
+func (c *codec) ReadResponseBody(body interface{}) error {
+	return decodeBody(c.msg.b, body)
+}
+
+func (c *codec) Close() error {
+	return c.rwc.Close()
+}
+
+func appendBody(b []byte, body interface{}) ([]byte, error) {
+	switch v := body.(type) {
+	case Input:
+		return AppendInput(append(b, bodyInput), &v), nil
+	case *Input:
+		return AppendInput(append(b, bodyInput), v), nil
+	case *Output:
+		return AppendOutput(append(b, bodyOutput), v), nil
+	}
+	j, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	return append(append(b, bodyJSON), j...), nil
+}
+
+func decodeBody(b []byte, body interface{}) error {
+	if body == nil {
+		return nil // discarded
+	}
+	if len(b) == 0 {
+		return ErrShortMessage
+	}
+	switch b[0] {
+	case bodyJSON:
+		return json.Unmarshal(b[1:], body)
+	case bodyInput:
+		if in, ok := body.(*Input); ok {
+			return DecodeInput(b[1:], in)
+		}
+	case bodyOutput:
+		switch out := body.(type) {
+		case *Output:
+			return DecodeOutput(b[1:], out)
+		case **Output:
+			if *out == nil {
+				*out = &Output{}
+			}
+			return DecodeOutput(b[1:], *out)
+		}
+	}
+	return fmt.Errorf("protocol: cannot decode body %q into %T", b[0], body)
+}
@@ -0,0 +1,475 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ProfileVersion is the schema version of Profile.
+const ProfileVersion = 1
+
+var vehicleFields = jsonFields(reflect.TypeOf(VehicleProfile{}))
+
+// migrations[n] upgrades a raw profile from version n to n+1.
+var migrations = []func(map[string]interface{}) error{
+	// 0 -> 1: vehicle parameters used to live at the top level.
+	func(raw map[string]interface{}) error {
+		vehicle, _ := raw["Vehicle"].(map[string]interface{})
+		if vehicle == nil {
+			vehicle = map[string]interface{}{}
+		}
+		for k, v := range raw {
+			switch k {
+			case "Version", "World", "Vehicle", "Quadcopter", "Sensors", "Failsafe", "Radio", "Tune", "Objects", "Damage", "Track", "Collision":
+				continue
+			}
+			if _, ok := vehicleFields[strings.ToLower(k)]; !ok {
+				continue // left to be reported as unknown
+			}
+			if _, ok := vehicle[k]; !ok {
+				vehicle[k] = v
+			}
+			delete(raw, k)
+		}
+		raw["Vehicle"] = vehicle
+		return nil
+	},
+}
+
+// DefaultProfile ...
+func DefaultProfile() Profile {
+	return Profile{
+		Version: ProfileVersion,
+		World: WorldProfile{
+			Gravity:                []float64{0, 0, -9.80665},
+			CFM:                    10e-5,
+			ERP:                    0.8,
+			QuickStepW:             1e-3,
+			QuickStepNumIterations: 10,
+			CollideNum:             2,
+			WheelContacts:          4,
+			ChassisContacts:        8,
+			SpaceType:              "hash",
+			Mu:                     1e-6,
+			SoftCfm:                1e-6,
+			SoftErp:                0.3,
+
+			AutoDisable:                 true,
+			AutoDisableLinearThreshold:  0.01,
+			AutoDisableAngularThreshold: 0.01,
+			AutoDisableSteps:            10,
+			AmbientTemp:                 20,
+		},
+		Vehicle: VehicleProfile{
+			Model:              "hinge2",
+			BodyDensity:        0.05,
+			BodyBox:            []float64{0.200, 0.050, 0.380},
+			BodyZOffset:        0.0,
+			Wheelbase:          0.267,
+			Tread:              0.160,
+			TireDensity:        0.03,
+			TireDiameter:       0.088,
+			TireWidth:          0.033,
+			FudgeFactorJtParam: 0.01,
+			SuspensionStep:     1.0,
+			SuspensionSpring:   100,
+			SuspensionDamping:  0.1,
+			SuspensionTravel:   0.01,
+			Camber:             15.0,
+			FinalDrive:         1.0,
+			Compound: TireCompound{
+				Name:        "medium",
+				Grip:        1.0,
+				OptimalTemp: 60,
+				TempWindow:  40,
+				HeatRate:    0.5,
+				CoolRate:    0.05,
+				WearRate:    1e-4,
+				WornGrip:    0.7,
+			},
+		},
+		Quadcopter: QuadcopterProfile{
+			FrameBox:      []float64{0.180, 0.180, 0.040},
+			Density:       0.05,
+			RotorDiameter: 0.076,
+			ThrustRatio:   2.0,
+			TorqueRatio:   0.01,
+			MaxClimb:      1.5,
+			MaxTilt:       30,
+			MaxYawRate:    180,
+			Response:      20,
+		},
+		Sensors: SensorProfile{
+			AccelNoise:    0.05,
+			AccelBias:     0.02,
+			GyroNoise:     0.005,
+			GyroBias:      0.002,
+			EncoderCounts: 64,
+			GPSNoise:      0.5,
+			GPSRate:       5,
+		},
+		Failsafe: FailsafeProfile{
+			Timeout:  0.5,
+			Throttle: -1,
+		},
+		Radio: RadioProfile{
+			Fade:        20,
+			Obstruction: 0.5,
+			Latency:     0.01,
+			MaxLatency:  0.2,
+		},
+		Objects: map[string]ObjectProfile{
+			"cone":    {Shape: "cylinder", Density: 0.5},
+			"barrier": {Shape: "box", Density: 2.0},
+			"ball":    {Shape: "sphere", Density: 0.3},
+		},
+		Damage: DamageProfile{
+			Enabled:   true,
+			Threshold: 0.01,
+			Scale:     20,
+			MaxBend:   10,
+		},
+		Track: TrackProfile{
+			CellSize:   0.25,
+			WetGrip:    0.6,
+			Dust:       0.5,
+			DustGrip:   0.2,
+			DustRate:   1e-3,
+			CleanRate:  0.02,
+			RubberRate: 0.005,
+			RubberGrip: 0.1,
+		},
+		Collision: CollisionProfile{
+			Mode:      "full",
+			GhostTime: 3,
+		},
+	}
+}
+
+// DecodeProfile reads a profile of any known version, upgrades it, fills
+// missing fields from DefaultProfile and validates the result.
+func DecodeProfile(r io.Reader) (Profile, error) {
+	profile := DefaultProfile()
+	raw := map[string]interface{}{}
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return profile, err
+	}
+	version := 0
+	if v, ok := raw["Version"].(float64); ok {
+		version = int(v)
+	}
+	if version > ProfileVersion {
+		return profile, fmt.Errorf("Version: %d is newer than supported %d", version, ProfileVersion)
+	}
+	for ; version < ProfileVersion; version++ {
+		if err := migrations[version](raw); err != nil {
+			return profile, fmt.Errorf("migrate %d -> %d: %v", version, version+1, err)
+		}
+	}
+	raw["Version"] = ProfileVersion
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return profile, err
+	}
+	if err := json.Unmarshal(b, &profile); err != nil {
+		return profile, err
+	}
+	c := checker{}
+	c.unknown(raw, reflect.TypeOf(profile), "")
+	if err := profile.Validate(); err != nil {
+		errs, ok := err.(ValidationError)
+		if !ok {
+			return profile, err
+		}
+		c = append(c, errs...)
+	}
+	if len(c) > 0 {
+		return profile, ValidationError(c)
+	}
+	return profile, nil
+}
+
+// jsonFields returns the fields of the struct type t by their JSON key in
+// lower case, which is how encoding/json matches them.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		if f.Anonymous && tag == "" && f.Type.Kind() == reflect.Struct {
+			for k, ft := range jsonFields(f.Type) {
+				fields[k] = ft
+			}
+			continue
+		}
+		if f.PkgPath != "" {
+			continue // unexported
+		}
+		name := f.Name
+		if n := strings.Split(tag, ",")[0]; n != "" {
+			name = n
+		}
+		fields[strings.ToLower(name)] = f.Type
+	}
+	return fields
+}
+
+// unknown reports the keys of raw, decoded JSON, that no field of t takes.
+// Mismatched types are left to encoding/json.
+func (c *checker) unknown(raw interface{}, t reflect.Type, path string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	join := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := raw.(map[string]interface{})
+		if !ok {
+			return
+		}
+		fields := jsonFields(t)
+		for _, k := range sortedKeys(m) {
+			ft, ok := fields[strings.ToLower(k)]
+			c.check(ok, join(k), "unknown field")
+			if ok {
+				c.unknown(m[k], ft, join(k))
+			}
+		}
+	case reflect.Map:
+		m, ok := raw.(map[string]interface{})
+		if !ok {
+			return
+		}
+		for _, k := range sortedKeys(m) {
+			c.unknown(m[k], t.Elem(), join(k))
+		}
+	case reflect.Slice, reflect.Array:
+		a, ok := raw.([]interface{})
+		if !ok {
+			return
+		}
+		for i, v := range a {
+			c.unknown(v, t.Elem(), fmt.Sprintf("%s[%d]", path, i))
+		}
+	}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// FieldError ...
+type FieldError struct {
+	Path string
+	Msg  string
+}
+
+func (e *FieldError) Error() string {
+	return e.Path + ": " + e.Msg
+}
+
+// ValidationError lists every problem found in a profile.
+type ValidationError []*FieldError
+
+func (e ValidationError) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+type checker ValidationError
+
+func (c *checker) check(ok bool, path, format string, args ...interface{}) {
+	if !ok {
+		*c = append(*c, &FieldError{Path: path, Msg: fmt.Sprintf(format, args...)})
+	}
+}
+
+func (c *checker) positive(path string, v float64) {
+	c.check(v > 0, path, "%v must be positive", v)
+}
+
+func (c *checker) between(path string, v, min, max float64) {
+	c.check(v >= min && v <= max, path, "%v out of range [%v, %v]", v, min, max)
+}
+
+func (c *checker) length(path string, v []float64, n int) bool {
+	c.check(len(v) == n, path, "need %d elements, got %d", n, len(v))
+	return len(v) == n
+}
+
+// Validate checks lengths and ranges of every field.
+func (p *Profile) Validate() error {
+	c := checker{}
+	c.check(p.Version == ProfileVersion, "Version", "%d, want %d", p.Version, ProfileVersion)
+	p.World.validate(&c, "World")
+	p.Vehicle.validate(&c, "Vehicle")
+	p.Quadcopter.validate(&c, "Quadcopter")
+	p.Sensors.validate(&c, "Sensors")
+	c.check(p.Failsafe.Timeout >= 0, "Failsafe.Timeout", "%v must not be negative", p.Failsafe.Timeout)
+	c.between("Failsafe.Steering", p.Failsafe.Steering, -1, 1)
+	c.between("Failsafe.Throttle", p.Failsafe.Throttle, -1, 1)
+	p.Radio.validate(&c, "Radio")
+	p.Tune.validate(&c, "Tune")
+	c.check(p.Damage.Threshold >= 0, "Damage.Threshold", "%v must not be negative", p.Damage.Threshold)
+	c.check(p.Damage.Scale >= 0, "Damage.Scale", "%v must not be negative", p.Damage.Scale)
+	c.between("Damage.MaxBend", p.Damage.MaxBend, 0, 45)
+	t := p.Track
+	c.positive("Track.CellSize", t.CellSize)
+	c.between("Track.Wetness", t.Wetness, 0, 1)
+	c.between("Track.WetGrip", t.WetGrip, 0, 1)
+	c.between("Track.Dust", t.Dust, 0, 1)
+	c.between("Track.DustGrip", t.DustGrip, 0, 1)
+	c.check(t.DustRate >= 0, "Track.DustRate", "%v must not be negative", t.DustRate)
+	c.between("Track.CleanRate", t.CleanRate, 0, 1)
+	c.between("Track.RubberRate", t.RubberRate, 0, 1)
+	c.check(t.RubberGrip >= 0, "Track.RubberGrip", "%v must not be negative", t.RubberGrip)
+	switch p.Collision.Mode {
+	case "full", "ghost", "reset", "team":
+	default:
+		c.check(false, "Collision.Mode", "%q is not full, ghost, reset or team", p.Collision.Mode)
+	}
+	c.check(p.Collision.GhostTime >= 0, "Collision.GhostTime", "%v must not be negative", p.Collision.GhostTime)
+	for kind, o := range p.Objects {
+		path := "Objects." + kind
+		switch o.Shape {
+		case "box", "cylinder", "sphere":
+		default:
+			c.check(false, path+".Shape", "%q is not box, cylinder or sphere", o.Shape)
+		}
+		c.positive(path+".Density", o.Density)
+	}
+	if len(c) > 0 {
+		return ValidationError(c)
+	}
+	return nil
+}
+
+func (w *WorldProfile) validate(c *checker, path string) {
+	c.length(path+".Gravity", w.Gravity, 3)
+	c.positive(path+".CFM", w.CFM)
+	c.between(path+".ERP", w.ERP, 0, 1)
+	c.positive(path+".QuickStepW", w.QuickStepW)
+	c.check(w.QuickStepNumIterations > 0, path+".QuickStepNumIterations", "%d must be positive", w.QuickStepNumIterations)
+	c.check(w.CollideNum > 0 && w.CollideNum <= 0xffff, path+".CollideNum", "%d out of range [1, 65535]", w.CollideNum)
+	c.check(w.WheelContacts >= 0 && w.WheelContacts <= 0xffff, path+".WheelContacts", "%d out of range [0, 65535]", w.WheelContacts)
+	c.check(w.ChassisContacts >= 0 && w.ChassisContacts <= 0xffff, path+".ChassisContacts", "%d out of range [0, 65535]", w.ChassisContacts)
+	switch w.SpaceType {
+	case "", "hash", "sap", "simple":
+	case "quadtree":
+		c.length(path+".QuadTreeCenter", w.QuadTreeCenter, 3)
+		c.length(path+".QuadTreeExtents", w.QuadTreeExtents, 3)
+		c.check(w.QuadTreeDepth > 0, path+".QuadTreeDepth", "%d must be positive", w.QuadTreeDepth)
+	default:
+		c.check(false, path+".SpaceType", "%q is not hash, sap, quadtree or simple", w.SpaceType)
+	}
+	c.check(w.Mu >= 0, path+".Mu", "%v must not be negative", w.Mu)
+	c.check(w.SoftCfm >= 0, path+".SoftCfm", "%v must not be negative", w.SoftCfm)
+	c.between(path+".SoftErp", w.SoftErp, 0, 1)
+	c.check(w.AutoDisableLinearThreshold >= 0, path+".AutoDisableLinearThreshold", "%v must not be negative", w.AutoDisableLinearThreshold)
+	c.check(w.AutoDisableAngularThreshold >= 0, path+".AutoDisableAngularThreshold", "%v must not be negative", w.AutoDisableAngularThreshold)
+	c.check(w.AutoDisableSteps >= 0, path+".AutoDisableSteps", "%d must not be negative", w.AutoDisableSteps)
+	c.check(w.AutoDisableTime >= 0, path+".AutoDisableTime", "%v must not be negative", w.AutoDisableTime)
+}
+
+func (v *VehicleProfile) validate(c *checker, path string) {
+	switch v.Model {
+	case "hinge2", "raycast":
+	default:
+		c.check(false, path+".Model", "%q is not hinge2 or raycast", v.Model)
+	}
+	c.positive(path+".BodyDensity", v.BodyDensity)
+	if c.length(path+".BodyBox", v.BodyBox, 3) {
+		for i, l := range v.BodyBox {
+			c.positive(fmt.Sprintf("%s.BodyBox[%d]", path, i), l)
+		}
+	}
+	c.positive(path+".Wheelbase", v.Wheelbase)
+	c.positive(path+".Tread", v.Tread)
+	c.positive(path+".TireDensity", v.TireDensity)
+	c.positive(path+".TireDiameter", v.TireDiameter)
+	c.positive(path+".TireWidth", v.TireWidth)
+	c.between(path+".FudgeFactorJtParam", v.FudgeFactorJtParam, 0, 1)
+	c.positive(path+".SuspensionStep", v.SuspensionStep)
+	c.positive(path+".SuspensionSpring", v.SuspensionSpring)
+	c.check(v.SuspensionDamping >= 0, path+".SuspensionDamping", "%v must not be negative", v.SuspensionDamping)
+	c.positive(path+".SuspensionTravel", v.SuspensionTravel)
+	c.between(path+".Camber", v.Camber, -45, 45)
+	c.positive(path+".FinalDrive", v.FinalDrive)
+	t, path := v.Compound, path+".Compound"
+	c.positive(path+".Grip", t.Grip)
+	c.positive(path+".TempWindow", t.TempWindow)
+	c.check(t.HeatRate >= 0, path+".HeatRate", "%v must not be negative", t.HeatRate)
+	c.check(t.CoolRate >= 0, path+".CoolRate", "%v must not be negative", t.CoolRate)
+	c.check(t.WearRate >= 0, path+".WearRate", "%v must not be negative", t.WearRate)
+	c.between(path+".WornGrip", t.WornGrip, 0, 1)
+}
+
+func (q *QuadcopterProfile) validate(c *checker, path string) {
+	if c.length(path+".FrameBox", q.FrameBox, 3) {
+		for i, l := range q.FrameBox {
+			c.positive(fmt.Sprintf("%s.FrameBox[%d]", path, i), l)
+		}
+	}
+	c.positive(path+".Density", q.Density)
+	c.positive(path+".RotorDiameter", q.RotorDiameter)
+	c.check(q.ThrustRatio > 1, path+".ThrustRatio", "%v cannot lift off, need more than 1", q.ThrustRatio)
+	c.positive(path+".TorqueRatio", q.TorqueRatio)
+	c.positive(path+".MaxClimb", q.MaxClimb)
+	c.between(path+".MaxTilt", q.MaxTilt, 0, 80)
+	c.positive(path+".MaxYawRate", q.MaxYawRate)
+	c.positive(path+".Response", q.Response)
+}
+
+func (s *SensorProfile) validate(c *checker, path string) {
+	c.check(s.AccelNoise >= 0, path+".AccelNoise", "%v must not be negative", s.AccelNoise)
+	c.check(s.AccelBias >= 0, path+".AccelBias", "%v must not be negative", s.AccelBias)
+	c.check(s.GyroNoise >= 0, path+".GyroNoise", "%v must not be negative", s.GyroNoise)
+	c.check(s.GyroBias >= 0, path+".GyroBias", "%v must not be negative", s.GyroBias)
+	c.check(s.EncoderCounts > 0, path+".EncoderCounts", "%d must be positive", s.EncoderCounts)
+	c.check(s.GPSNoise >= 0, path+".GPSNoise", "%v must not be negative", s.GPSNoise)
+	c.check(s.GPSRate >= 0, path+".GPSRate", "%v must not be negative", s.GPSRate)
+}
+
+func (r *RadioProfile) validate(c *checker, path string) {
+	c.check(r.Range >= 0, path+".Range", "%v must not be negative", r.Range)
+	c.check(r.Fade >= 0, path+".Fade", "%v must not be negative", r.Fade)
+	c.between(path+".Obstruction", r.Obstruction, 0, 1)
+	c.check(r.Latency >= 0, path+".Latency", "%v must not be negative", r.Latency)
+	c.check(r.MaxLatency >= r.Latency, path+".MaxLatency", "%v must not be below Latency", r.MaxLatency)
+}
+
+func (l *TuneLimits) validate(c *checker, path string) {
+	min, max := reflect.ValueOf(l.Min), reflect.ValueOf(l.Max)
+	for i := 0; i < min.NumField(); i++ {
+		name := min.Type().Field(i).Name
+		switch min.Field(i).Kind() {
+		case reflect.Float64:
+			lo, hi := min.Field(i).Float(), max.Field(i).Float()
+			c.check(lo <= hi, path+".Min."+name, "%v greater than Max %v", lo, hi)
+		case reflect.Slice:
+			if min.Field(i).Len() != max.Field(i).Len() {
+				c.check(false, path+".Max."+name, "length %d differs from Min %d", max.Field(i).Len(), min.Field(i).Len())
+			}
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package protocol
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDecodeProfile(t *testing.T) {
+	fp, err := os.Open("../profile.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fp.Close()
+	if _, err := DecodeProfile(fp); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateFlatProfile(t *testing.T) {
+	src := `{"BodyDensity": 0.2, "Tread": 0.18, "World": {"Mu": 0.5}}`
+	p, err := DecodeProfile(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Version != ProfileVersion {
+		t.Errorf("version: %d", p.Version)
+	}
+	if p.Vehicle.BodyDensity != 0.2 || p.Vehicle.Tread != 0.18 {
+		t.Errorf("vehicle fields not migrated: %+v", p.Vehicle)
+	}
+	if p.World.Mu != 0.5 || len(p.World.Gravity) != 3 {
+		t.Errorf("world defaults not filled: %+v", p.World)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	src := `{"Version": 1, "World": {"Gravity": []}, "Vehicle": {"BodyBox": [0.1, 0.2]}, "Failsafe": {"Timeout": -1}}`
+	_, err := DecodeProfile(strings.NewReader(src))
+	errs, ok := err.(ValidationError)
+	if !ok {
+		t.Fatalf("expected ValidationError: %v", err)
+	}
+	paths := map[string]bool{}
+	for _, e := range errs {
+		paths[e.Path] = true
+	}
+	for _, path := range []string{"World.Gravity", "Vehicle.BodyBox", "Failsafe.Timeout"} {
+		if !paths[path] {
+			t.Errorf("missing problem for %s: %v", path, err)
+		}
+	}
+}
+
+func TestUnknownFields(t *testing.T) {
+	src := `{"Version": 1, "Gravty": [0, 0, -9.8], "Vehicle": {"Camberr": 3, "camber": 10}, "Objects": {"cone": {"Shap": "box"}}}`
+	p, err := DecodeProfile(strings.NewReader(src))
+	errs, ok := err.(ValidationError)
+	if !ok {
+		t.Fatalf("expected ValidationError: %v", err)
+	}
+	paths := map[string]bool{}
+	for _, e := range errs {
+		paths[e.Path] = true
+	}
+	for _, path := range []string{"Gravty", "Vehicle.Camberr", "Objects.cone.Shap"} {
+		if !paths[path] {
+			t.Errorf("missing problem for %s: %v", path, err)
+		}
+	}
+	if paths["Vehicle.camber"] || p.Vehicle.Camber != 10 {
+		t.Errorf("case-insensitive field: %v %v", p.Vehicle.Camber, err)
+	}
+}
+
+func TestMigrateUnknownField(t *testing.T) {
+	src := `{"BodyDensity": 0.2, "Gravty": [0, 0, -9.8]}`
+	p, err := DecodeProfile(strings.NewReader(src))
+	errs, ok := err.(ValidationError)
+	if !ok || len(errs) != 1 || errs[0].Path != "Gravty" {
+		t.Fatalf("expected only Gravty unknown: %v", err)
+	}
+	if p.Vehicle.BodyDensity != 0.2 {
+		t.Errorf("vehicle field not migrated: %+v", p.Vehicle)
+	}
+}
@@ -1,5 +1,7 @@
 package protocol
 
+import "math"
+
 // WorldProfile ...
 type WorldProfile struct {
 	Gravity                []float64
@@ -7,14 +9,40 @@ type WorldProfile struct {
 	ERP                    float64
 	QuickStepW             float64
 	QuickStepNumIterations int
-	CollideNum             int
+	CollideNum             int       // max contacts per geom pair
+	WheelContacts          int       // max contacts of a wheel pair, 0: CollideNum
+	ChassisContacts        int       // max contacts of a chassis pair, 0: CollideNum
+	SpaceType              string    // hash(default), sap, quadtree or simple; fixed at startup
+	QuadTreeCenter         []float64 // quadtree only
+	QuadTreeExtents        []float64 // quadtree only
+	QuadTreeDepth          int       // quadtree only
 	Mu                     float64
 	SoftCfm                float64
 	SoftErp                float64
+	// auto-disable of resting bodies (ode defaults: 0.01, 0.01, 10, 0)
+	AutoDisable                 bool
+	AutoDisableLinearThreshold  float64
+	AutoDisableAngularThreshold float64
+	AutoDisableSteps            int
+	AutoDisableTime             float64
+	AmbientTemp                 float64 // degC, tires cool toward this
+}
+
+// TireCompound ...
+type TireCompound struct {
+	Name        string
+	Grip        float64 // friction multiplier at optimal temperature, new tire
+	OptimalTemp float64 // degC
+	TempWindow  float64 // degC from optimal where grip has dropped the most
+	HeatRate    float64 // degC per J of slip energy
+	CoolRate    float64 // 1/s toward ambient
+	WearRate    float64 // wear per J of slip energy, 1.0 = worn out
+	WornGrip    float64 // grip factor of a worn out tire
 }
 
 // VehicleProfile ...
 type VehicleProfile struct {
+	Model              string    // hinge2(default) or raycast
 	BodyDensity        float64   // default 0.2
 	BodyBox            []float64 // { width, height, length }
 	BodyZOffset        float64   // Offset Adjust from center of wheels
@@ -27,20 +55,123 @@ type VehicleProfile struct {
 	SuspensionStep     float64
 	SuspensionSpring   float64
 	SuspensionDamping  float64
+	SuspensionTravel   float64 // raycast only: m from full droop to full bump
+	Camber             float64 // default 15deg
+	FinalDrive         float64 // default 1.0: drive speed multiplier, torque divisor
+	Compound           TireCompound
+}
+
+// QuadcopterProfile ...
+type QuadcopterProfile struct {
+	FrameBox      []float64 // { x, y, z } m, rotors at the corners of the top face
+	Density       float64
+	RotorDiameter float64 // m
+	ThrustRatio   float64 // thrust of all rotors at full power / weight
+	TorqueRatio   float64 // Nm of yaw reaction per N of rotor thrust
+	MaxClimb      float64 // m/s at full accel or brake
+	MaxTilt       float64 // deg at full pitch or roll
+	MaxYawRate    float64 // deg/s at full steering
+	Response      float64 // 1/s, how fast the flight controller corrects
+}
+
+// SensorProfile ...
+type SensorProfile struct {
+	AccelNoise    float64 // m/s^2, standard deviation per sample and axis
+	AccelBias     float64 // m/s^2, standard deviation of the fixed bias per axis
+	GyroNoise     float64 // rad/s, standard deviation per sample and axis
+	GyroBias      float64 // rad/s, standard deviation of the fixed bias per axis
+	EncoderCounts int     // counts per wheel revolution
+	GPSNoise      float64 // m, standard deviation per axis
+	GPSRate       float64 // Hz, 0: no GPS
+}
+
+// FailsafeProfile is what a vehicle does when its player's input stops
+// arriving, like the failsafe of an RC receiver.
+type FailsafeProfile struct {
+	Timeout  float64 // s without World.Update before the failsafe, 0: off
+	Steering float64 // -1..1 held while the signal is lost
+	Throttle float64 // -1..1, 0: neutral, negative brakes (quadcopters descend)
+}
+
+// Input returns the input held by the failsafe.
+func (p FailsafeProfile) Input() Input {
+	return Input{
+		Steering: p.Steering,
+		Accel:    math.Max(0, p.Throttle),
+		Brake:    math.Max(0, -p.Throttle),
+	}
+}
+
+// RadioProfile models the radio link between the driver stand of the track
+// and the vehicles. The signal is full within Range, fades out over Fade
+// beyond it and is weakened without line of sight; inputs are delayed and
+// lost more as it weakens. It needs a track with a driver stand.
+type RadioProfile struct {
+	Range       float64 // m of full signal from the driver stand, 0: off
+	Fade        float64 // m beyond Range until the signal is gone
+	Obstruction float64 // 0..1, share of the signal lost without line of sight
+	Latency     float64 // s at full signal
+	MaxLatency  float64 // s at no signal
+}
+
+// ObjectProfile ...
+type ObjectProfile struct {
+	Shape   string // box, cylinder or sphere
+	Density float64
+}
+
+// DamageProfile ...
+type DamageProfile struct {
+	Enabled   bool
+	Threshold float64 // contact impulse N*s below which nothing breaks
+	Scale     float64 // damage per N*s above the threshold
+	MaxBend   float64 // deg, camber change of a broken corner
+}
+
+// TrackProfile ...
+type TrackProfile struct {
+	CellSize   float64 // m, grid resolution of the track condition
+	Wetness    float64 // 0: dry, 1: soaked; initial value
+	WetGrip    float64 // grip factor when soaked
+	Dust       float64 // initial dust 0..1
+	DustGrip   float64 // grip lost at full dust
+	DustRate   float64 // 1/s, dust settling on untouched cells
+	CleanRate  float64 // share of dust swept away per wheel pass
+	RubberRate float64 // share of missing rubber laid down per wheel pass
+	RubberGrip float64 // grip gained when fully rubbered in
+}
+
+// CollisionProfile ...
+type CollisionProfile struct {
+	Mode      string  // full, ghost, reset or team
+	GhostTime float64 // s, ghosting after a (re)spawn in reset mode
 }
 
 // Profile ...
 type Profile struct {
-	World   WorldProfile
-	Vehicle VehicleProfile
+	Version    int // see ProfileVersion
+	World      WorldProfile
+	Vehicle    VehicleProfile
+	Quadcopter QuadcopterProfile
+	Sensors    SensorProfile
+	Failsafe   FailsafeProfile
+	Radio      RadioProfile
+	Tune       TuneLimits               // per-player setup bounds
+	Objects    map[string]ObjectProfile // dynamic track objects by kind (dyn_<kind>_*)
+	Damage     DamageProfile
+	Track      TrackProfile
+	Collision  CollisionProfile
 }
 
 // Input ...
 type Input struct {
-	Name     string  `json:"name"`
-	Steering float64 `json:"steering"`
-	Accel    float64 `json:"accel"`
-	Brake    float64 `json:"brake"`
+	Name      string  `json:"name"`
+	Steering  float64 `json:"steering"`
+	Accel     float64 `json:"accel"`
+	Brake     float64 `json:"brake"`
+	Pitch     float64 `json:"pitch,omitempty"`     // quadcopter: -1..1, positive flies forward
+	Roll      float64 `json:"roll,omitempty"`      // quadcopter: -1..1, positive flies right
+	Telemetry bool    `json:"telemetry,omitempty"` // request Self.Telemetry
 }
 
 // Attitude ...
@@ -49,15 +180,127 @@ type Attitude struct {
 	Quaternion []float64 `json:"quaternion"` // length=4
 }
 
+// WheelTelemetry ...
+type WheelTelemetry struct {
+	Contact          bool    `json:"contact"`
+	SlipRatio        float64 `json:"slipRatio"`
+	SlipAngle        float64 `json:"slipAngle"`        // rad
+	Load             float64 `json:"load"`             // N
+	SuspensionTravel float64 `json:"suspensionTravel"` // m, compression positive
+	AngularVelocity  float64 `json:"angularVelocity"`  // rad/s around the axle
+	Temperature      float64 `json:"temperature"`      // degC
+	Wear             float64 `json:"wear"`             // 0: new, 1: worn out
+}
+
+// Damage ...
+type Damage struct {
+	Steering   float64   `json:"steering"`   // 0: intact, 1: broken
+	Motor      float64   `json:"motor"`      // 0: intact, 1: broken
+	Suspension []float64 `json:"suspension"` // per corner, same order as Tires
+}
+
+// Telemetry ...
+type Telemetry struct {
+	LinearVelocity  []float64        `json:"linearVelocity"`  // m/s
+	AngularVelocity []float64        `json:"angularVelocity"` // rad/s
+	Wheels          []WheelTelemetry `json:"wheels"`
+	Rotors          []float64        `json:"rotors,omitempty"` // quadcopter: N of thrust per rotor
+	Signal          float64          `json:"signal"`           // radio link quality, 0: none, 1: full
+	Damage          Damage           `json:"damage"`
+}
+
+// IMUSample is one reading of the accelerometer, gyro and wheel encoders,
+// taken after every simulation step. Body axes: x right, y forward, z up.
+type IMUSample struct {
+	Time     float64   `json:"time"`     // simulated s
+	Accel    []float64 `json:"accel"`    // m/s^2, specific force: 9.8 up at rest
+	Gyro     []float64 `json:"gyro"`     // rad/s
+	Encoders []int64   `json:"encoders"` // counts per wheel, rolling forward positive
+}
+
+// GPSFix ...
+type GPSFix struct {
+	Time     float64   `json:"time"`     // simulated s
+	Position []float64 `json:"position"` // m, world axes
+}
+
+// Sensors holds the readings taken since the previous World.Sensors call.
+type Sensors struct {
+	IMU []IMUSample `json:"imu"`
+	GPS []GPSFix    `json:"gps"`
+}
+
+// Vehicle kinds a player can join with.
+const (
+	KindCar        = "car"
+	KindQuadcopter = "quadcopter"
+)
+
+// Join ...
+type Join struct {
+	Name string `json:"name"`
+	Kind string `json:"kind,omitempty"` // car(default) or quadcopter
+}
+
 // Vehicle ...
 type Vehicle struct {
-	Name  string
-	Body  Attitude   `json:"body"`
-	Tires []Attitude `json:"tires"`
+	Name       string
+	Kind       string     `json:"kind,omitempty"` // empty: car
+	Body       Attitude   `json:"body"`
+	Tires      []Attitude `json:"tires"`                // wheels, or rotors of a quadcopter
+	Sleeping   bool       `json:"sleeping,omitempty"`   // attitudes omitted when unchanged
+	SignalLost bool       `json:"signalLost,omitempty"` // failsafe engaged, no input from the player
+	Telemetry  *Telemetry `json:"telemetry,omitempty"`  // owning client only
+}
+
+// Object ...
+type Object struct {
+	Name  string    `json:"name"`
+	Shape string    `json:"shape"`
+	Size  []float64 `json:"size"` // box lengths or {diameter, diameter, length}
+	Body  Attitude  `json:"body"`
+}
+
+// Kinematic is an animated track element, a scene node moved by the
+// server. Body is the world pose of the node without its scale.
+type Kinematic struct {
+	Name string   `json:"name"`
+	Body Attitude `json:"body"`
+}
+
+// Weather ...
+type Weather struct {
+	Token   string  `json:"token,omitempty"` // admin token
+	Wetness float64 `json:"wetness"`         // 0: dry, 1: soaked
+}
+
+// Control ...
+type Control struct {
+	Token     string  `json:"token,omitempty"` // admin token
+	Op        string  `json:"op"`              // pause, resume, step or scale
+	Steps     int     `json:"steps,omitempty"` // for step
+	TimeScale float64 `json:"timeScale"`       // for scale
+	Paused    bool    `json:"paused"`
+}
+
+// ObjectReset ...
+type ObjectReset struct {
+	Token string `json:"token,omitempty"` // admin token
+}
+
+// Team ...
+type Team struct {
+	Token string `json:"token,omitempty"` // admin token
+	Name  string `json:"name"`
+	Team  int    `json:"team"`
 }
 
 // Output ...
 type Output struct {
-	Self   *Vehicle
-	Others []*Vehicle
+	Self       *Vehicle
+	Others     []*Vehicle
+	Objects    []*Object    `json:"objects,omitempty"`
+	Kinematics []*Kinematic `json:"kinematics,omitempty"`
+	TimeScale  float64      `json:"timeScale"`
+	Paused     bool         `json:"paused,omitempty"`
 }
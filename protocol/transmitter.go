@@ -0,0 +1,95 @@
+package protocol
+
+import (
+	"encoding/json"
+	"math"
+)
+
+// Channel shapes one stick axis like a channel of an RC transmitter.
+// Stick values run from -1 to 1; the steps apply in field order.
+type Channel struct {
+	Reverse  bool    `json:"reverse,omitempty"`
+	Deadzone float64 `json:"deadzone"` // share of travel around center read as 0
+	Expo     float64 `json:"expo"`     // 0: linear, 1: cubic, softer around center
+	Rate     float64 `json:"rate"`     // dual rate, travel multiplier
+	Trim     float64 `json:"trim"`     // offset of center
+	EndLow   float64 `json:"endLow"`   // end point of negative travel
+	EndHigh  float64 `json:"endHigh"`  // end point of positive travel
+}
+
+// Transmitter is a player's input profile. Throttle is accel positive and
+// brake negative; pitch and roll are only used by quadcopters.
+type Transmitter struct {
+	Steering Channel `json:"steering"`
+	Throttle Channel `json:"throttle"`
+	Pitch    Channel `json:"pitch"`
+	Roll     Channel `json:"roll"`
+}
+
+// TransmitterSetup ...
+type TransmitterSetup struct {
+	Name  string          `json:"name"`
+	Setup json.RawMessage `json:"setup"` // partial Transmitter
+}
+
+// DefaultTransmitter passes inputs through, but for a little throttle
+// deadzone to keep worn gamepad sticks from creeping.
+func DefaultTransmitter() Transmitter {
+	linear := Channel{Rate: 1, EndLow: 1, EndHigh: 1}
+	throttle := linear
+	throttle.Deadzone = 0.1
+	return Transmitter{Steering: linear, Throttle: throttle, Pitch: linear, Roll: linear}
+}
+
+// Shape maps a stick value to the channel output, both in [-1, 1].
+func (c *Channel) Shape(v float64) float64 {
+	v = math.Max(-1, math.Min(1, v))
+	if c.Reverse {
+		v = -v
+	}
+	if math.Abs(v) <= c.Deadzone {
+		v = 0
+	} else {
+		v = math.Copysign((math.Abs(v)-c.Deadzone)/(1-c.Deadzone), v)
+	}
+	v = ((1-c.Expo)*v + c.Expo*v*v*v) * c.Rate
+	v += c.Trim
+	if v < 0 {
+		v *= c.EndLow
+	} else {
+		v *= c.EndHigh
+	}
+	return math.Max(-1, math.Min(1, v))
+}
+
+// Apply returns in shaped by the transmitter.
+func (t *Transmitter) Apply(in Input) Input {
+	in.Steering = t.Steering.Shape(in.Steering)
+	throttle := t.Throttle.Shape(in.Accel - in.Brake)
+	in.Accel, in.Brake = math.Max(0, throttle), math.Max(0, -throttle)
+	in.Pitch = t.Pitch.Shape(in.Pitch)
+	in.Roll = t.Roll.Shape(in.Roll)
+	return in
+}
+
+// Validate checks the range of every channel.
+func (t *Transmitter) Validate() error {
+	c := checker{}
+	t.Steering.validate(&c, "Steering")
+	t.Throttle.validate(&c, "Throttle")
+	t.Pitch.validate(&c, "Pitch")
+	t.Roll.validate(&c, "Roll")
+	if len(c) > 0 {
+		return ValidationError(c)
+	}
+	return nil
+}
+
+func (c *Channel) validate(ck *checker, path string) {
+	ck.check(c.Deadzone >= 0 && c.Deadzone < 1, path+".Deadzone", "%v out of range [0, 1)", c.Deadzone)
+	ck.between(path+".Expo", c.Expo, 0, 1)
+	ck.between(path+".Rate", c.Rate, 0, 1)
+	ck.between(path+".Trim", c.Trim, -0.25, 0.25)
+	ck.between(path+".EndLow", c.EndLow, 0, 1.2)
+	ck.between(path+".EndHigh", c.EndHigh, 0, 1.2)
+}
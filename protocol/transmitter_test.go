@@ -0,0 +1,45 @@
+package protocol
+
+import (
+	"math"
+	"testing"
+)
+
+func TestChannelShape(t *testing.T) {
+	c := Channel{Deadzone: 0.1, Expo: 0.5, Rate: 0.8, EndLow: 1, EndHigh: 1}
+	for _, tc := range []struct{ in, out float64 }{
+		{0.05, 0},
+		{-0.1, 0},
+		{1, 0.8},
+		{-1, -0.8},
+		{0.55, 0.8 * (0.5*0.5 + 0.5*0.125)},
+		{2, 0.8},
+	} {
+		if got := c.Shape(tc.in); math.Abs(got-tc.out) > 1e-9 {
+			t.Errorf("Shape(%v) = %v, want %v", tc.in, got, tc.out)
+		}
+	}
+	c = Channel{Reverse: true, Rate: 1, Trim: 0.1, EndLow: 0.5, EndHigh: 1.2}
+	if got := c.Shape(1); math.Abs(got-(-0.45)) > 1e-9 {
+		t.Errorf("reversed: %v", got)
+	}
+	if got := c.Shape(-1); got != 1 {
+		t.Errorf("end point not clamped: %v", got)
+	}
+}
+
+func TestTransmitterApply(t *testing.T) {
+	tx := DefaultTransmitter()
+	in := tx.Apply(Input{Name: "p", Steering: 0.5, Accel: 0.05})
+	if in.Name != "p" || in.Steering != 0.5 || in.Accel != 0 || in.Brake != 0 {
+		t.Errorf("default: %+v", in)
+	}
+	tx.Throttle.Reverse = true
+	if in := tx.Apply(Input{Accel: 1}); in.Accel != 0 || in.Brake != 1 {
+		t.Errorf("reversed throttle: %+v", in)
+	}
+	tx.Steering.Rate = 2
+	if err := tx.Validate(); err == nil {
+		t.Error("rate 2 accepted")
+	}
+}
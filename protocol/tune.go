@@ -0,0 +1,63 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// TuneLimits bounds the setup a player may choose.
+// A field is tunable only when its Min or Max is non-zero.
+type TuneLimits struct {
+	Min VehicleProfile
+	Max VehicleProfile
+}
+
+// Check reports the first field of setup that differs from base and is
+// either locked or out of bounds.
+func (l TuneLimits) Check(base, setup VehicleProfile) error {
+	b, s := reflect.ValueOf(base), reflect.ValueOf(setup)
+	min, max := reflect.ValueOf(l.Min), reflect.ValueOf(l.Max)
+	for i := 0; i < b.NumField(); i++ {
+		name := b.Type().Field(i).Name
+		if reflect.DeepEqual(b.Field(i).Interface(), s.Field(i).Interface()) {
+			continue
+		}
+		switch b.Field(i).Kind() {
+		case reflect.Float64:
+			if err := checkRange(name, s.Field(i).Float(), min.Field(i).Float(), max.Field(i).Float()); err != nil {
+				return err
+			}
+		case reflect.Slice:
+			lo, hi := min.Field(i).Interface().([]float64), max.Field(i).Interface().([]float64)
+			vs := s.Field(i).Interface().([]float64)
+			if len(vs) != b.Field(i).Len() || len(lo) != len(vs) || len(hi) != len(vs) {
+				return fmt.Errorf("%s: not tunable", name)
+			}
+			for j, v := range vs {
+				if err := checkRange(fmt.Sprintf("%s[%d]", name, j), v, lo[j], hi[j]); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("%s: not tunable", name)
+		}
+	}
+	return nil
+}
+
+func checkRange(name string, v, min, max float64) error {
+	if min == 0 && max == 0 {
+		return fmt.Errorf("%s: not tunable", name)
+	}
+	if v < min || v > max {
+		return fmt.Errorf("%s: %v out of range [%v, %v]", name, v, min, max)
+	}
+	return nil
+}
+
+// Tune ...
+type Tune struct {
+	Name  string          `json:"name"`
+	Setup json.RawMessage `json:"setup"` // partial VehicleProfile
+}
@@ -0,0 +1,48 @@
+package protocol
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTuneLimits(t *testing.T) {
+	base := DefaultProfile().Vehicle
+	limits := TuneLimits{}
+	limits.Min.FinalDrive, limits.Max.FinalDrive = 0.5, 2
+	limits.Min.BodyBox = []float64{0.1, 0.05, 0.3}
+	limits.Max.BodyBox = []float64{0.3, 0.05, 0.5}
+	for _, c := range []struct {
+		name  string
+		tune  func(*VehicleProfile)
+		error string // part of the error, "": accepted
+	}{
+		{"unchanged", func(p *VehicleProfile) {}, ""},
+		{"in bounds", func(p *VehicleProfile) { p.FinalDrive = 1.5 }, ""},
+		{"at the bound", func(p *VehicleProfile) { p.FinalDrive = 2 }, ""},
+		{"out of range", func(p *VehicleProfile) { p.FinalDrive = 3 }, "FinalDrive: 3 out of range"},
+		{"locked", func(p *VehicleProfile) { p.Camber = 5 }, "Camber: not tunable"},
+		{"locked string", func(p *VehicleProfile) { p.Model = "raycast" }, "Model: not tunable"},
+		{"slice in bounds", func(p *VehicleProfile) { p.BodyBox = []float64{0.25, 0.05, 0.4} }, ""},
+		{"slice out of range", func(p *VehicleProfile) { p.BodyBox = []float64{0.25, 0.05, 0.6} }, "BodyBox[2]: 0.6 out of range"},
+		{"slice locked element", func(p *VehicleProfile) { p.BodyBox = []float64{0.2, 0.06, 0.38} }, "BodyBox[1]: 0.06 out of range"},
+		{"slice length", func(p *VehicleProfile) { p.BodyBox = []float64{0.2, 0.05} }, "BodyBox: not tunable"},
+		{"compound", func(p *VehicleProfile) { p.Compound.Grip = 1.2 }, "Compound: not tunable"},
+	} {
+		setup := base
+		setup.BodyBox = append([]float64(nil), base.BodyBox...)
+		c.tune(&setup)
+		err := limits.Check(base, setup)
+		switch {
+		case c.error == "" && err != nil:
+			t.Errorf("%s: %v", c.name, err)
+		case c.error != "" && (err == nil || !strings.Contains(err.Error(), c.error)):
+			t.Errorf("%s: got %v, want %q", c.name, err, c.error)
+		}
+	}
+	// without limits nothing is tunable
+	setup := base
+	setup.TireDiameter = 0.1
+	if err := (TuneLimits{}).Check(base, setup); err == nil {
+		t.Error("tuned without limits")
+	}
+}
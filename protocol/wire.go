@@ -0,0 +1,369 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+)
+
+// Subprotocol is the websocket subprotocol of the binary wire format.
+// Clients that do not offer it talk JSON-RPC.
+const Subprotocol = "rccargo.bin.v1"
+
+// PositionStep is the resolution of positions on the wire, m. Positions
+// are sent as int32 multiples of it, so they reach about ±214km.
+const PositionStep = 1e-4
+
+// quaternionBits is the resolution of each of the three smallest
+// quaternion components on the wire; with the index of the largest one
+// they fill a uint32.
+const quaternionBits = 10
+
+// ErrShortMessage is returned when a message ends before its contents.
+var ErrShortMessage = errors.New("protocol: short message")
+
+const (
+	vehicleBody = 1 << iota
+	vehicleSleeping
+	vehicleSignalLost
+	vehicleTelemetry
+)
+
+const (
+	outputSelf = 1 << iota
+	outputPaused
+)
+
+const inputTelemetry = 1
+
+// AppendInput appends the binary encoding of in to b. Stick values are
+// clamped to -1..1.
+func AppendInput(b []byte, in *Input) []byte {
+	w := writer(b)
+	w.str(in.Name)
+	for _, v := range []float64{in.Steering, in.Accel, in.Brake, in.Pitch, in.Roll} {
+		w.axis(v)
+	}
+	flags := byte(0)
+	if in.Telemetry {
+		flags |= inputTelemetry
+	}
+	w.u8(flags)
+	return w
+}
+
+// DecodeInput decodes an input encoded by AppendInput.
+func DecodeInput(b []byte, in *Input) error {
+	r := &reader{b: b}
+	*in = Input{Name: r.str()}
+	for _, v := range []*float64{&in.Steering, &in.Accel, &in.Brake, &in.Pitch, &in.Roll} {
+		*v = r.axis()
+	}
+	in.Telemetry = r.u8()&inputTelemetry != 0
+	return r.err
+}
+
+// AppendOutput appends the binary encoding of out to b. Positions are
+// quantised to PositionStep and quaternions sent as their smallest three
+// components; telemetry, sent to its owner only, stays JSON.
+func AppendOutput(b []byte, out *Output) []byte {
+	w := writer(b)
+	flags := byte(0)
+	if out.Self != nil {
+		flags |= outputSelf
+	}
+	if out.Paused {
+		flags |= outputPaused
+	}
+	w.u8(flags)
+	w.f32(out.TimeScale)
+	if out.Self != nil {
+		w.vehicle(out.Self)
+	}
+	w.uvarint(uint64(len(out.Others)))
+	for _, v := range out.Others {
+		w.vehicle(v)
+	}
+	w.uvarint(uint64(len(out.Objects)))
+	for _, o := range out.Objects {
+		w.str(o.Name)
+		w.str(o.Shape)
+		w.uvarint(uint64(len(o.Size)))
+		for _, s := range o.Size {
+			w.f32(s)
+		}
+		w.attitude(o.Body)
+	}
+	w.uvarint(uint64(len(out.Kinematics)))
+	for _, k := range out.Kinematics {
+		w.str(k.Name)
+		w.attitude(k.Body)
+	}
+	return w
+}
+
+// DecodeOutput decodes an output encoded by AppendOutput.
+func DecodeOutput(b []byte, out *Output) error {
+	r := &reader{b: b}
+	*out = Output{}
+	flags := r.u8()
+	out.Paused = flags&outputPaused != 0
+	out.TimeScale = r.f32()
+	if flags&outputSelf != 0 {
+		out.Self = r.vehicle()
+	}
+	for n := r.count(); n > 0; n-- {
+		out.Others = append(out.Others, r.vehicle())
+	}
+	for n := r.count(); n > 0; n-- {
+		o := &Object{Name: r.str(), Shape: r.str()}
+		for m := r.count(); m > 0; m-- {
+			o.Size = append(o.Size, r.f32())
+		}
+		o.Body = r.attitude()
+		out.Objects = append(out.Objects, o)
+	}
+	for n := r.count(); n > 0; n-- {
+		out.Kinematics = append(out.Kinematics, &Kinematic{Name: r.str(), Body: r.attitude()})
+	}
+	return r.err
+}
+
+// PackQuaternion packs a unit quaternion {w, x, y, z} into 32 bits: the
+// index of the largest component and the other three, which lie within
+// ±1/√2 once the largest is made positive.
+func PackQuaternion(q []float64) uint32 {
+	l := math.Sqrt(q[0]*q[0] + q[1]*q[1] + q[2]*q[2] + q[3]*q[3])
+	if l == 0 {
+		q, l = []float64{1, 0, 0, 0}, 1
+	}
+	largest := 0
+	for i := 1; i < 4; i++ {
+		if math.Abs(q[i]) > math.Abs(q[largest]) {
+			largest = i
+		}
+	}
+	s := 1 / l
+	if q[largest] < 0 {
+		s = -s
+	}
+	const max = 1<<quaternionBits - 1
+	bits := uint32(largest) << (3 * quaternionBits)
+	shift := uint(2 * quaternionBits)
+	for i := 0; i < 4; i++ {
+		if i == largest {
+			continue
+		}
+		v := (q[i]*s*math.Sqrt2 + 1) / 2
+		bits |= uint32(math.Round(math.Max(0, math.Min(1, v))*max)) << shift
+		shift -= quaternionBits
+	}
+	return bits
+}
+
+// UnpackQuaternion unpacks a quaternion packed by PackQuaternion.
+func UnpackQuaternion(bits uint32) []float64 {
+	const max = 1<<quaternionBits - 1
+	q := make([]float64, 4)
+	largest := int(bits >> (3 * quaternionBits))
+	shift := uint(2 * quaternionBits)
+	sum := 0.0
+	for i := 0; i < 4; i++ {
+		if i == largest {
+			continue
+		}
+		q[i] = (float64(bits>>shift&max)/max*2 - 1) / math.Sqrt2
+		sum += q[i] * q[i]
+		shift -= quaternionBits
+	}
+	q[largest] = math.Sqrt(math.Max(0, 1-sum))
+	return q
+}
+
+type writer []byte
+
+func (w *writer) u8(c byte) {
+	*w = append(*w, c)
+}
+
+func (w *writer) uvarint(x uint64) {
+	var p [binary.MaxVarintLen64]byte
+	*w = append(*w, p[:binary.PutUvarint(p[:], x)]...)
+}
+
+func (w *writer) str(s string) {
+	w.uvarint(uint64(len(s)))
+	*w = append(*w, s...)
+}
+
+func (w *writer) u32(x uint32) {
+	*w = append(*w, byte(x), byte(x>>8), byte(x>>16), byte(x>>24))
+}
+
+func (w *writer) f32(f float64) {
+	w.u32(math.Float32bits(float32(f)))
+}
+
+func (w *writer) axis(v float64) {
+	v = math.Max(-1, math.Min(1, v))
+	x := uint16(int16(math.Round(v * math.MaxInt16)))
+	*w = append(*w, byte(x), byte(x>>8))
+}
+
+func (w *writer) attitude(a Attitude) {
+	for i := 0; i < 3; i++ {
+		p := 0.0
+		if i < len(a.Position) {
+			p = a.Position[i]
+		}
+		p = math.Max(math.MinInt32, math.Min(math.MaxInt32, math.Round(p/PositionStep)))
+		w.u32(uint32(int32(p)))
+	}
+	q := a.Quaternion
+	if len(q) != 4 {
+		q = []float64{1, 0, 0, 0}
+	}
+	w.u32(PackQuaternion(q))
+}
+
+func (w *writer) vehicle(v *Vehicle) {
+	flags := byte(0)
+	if v.Body.Position != nil {
+		flags |= vehicleBody
+	}
+	if v.Sleeping {
+		flags |= vehicleSleeping
+	}
+	if v.SignalLost {
+		flags |= vehicleSignalLost
+	}
+	var telemetry []byte
+	if v.Telemetry != nil {
+		if b, err := json.Marshal(v.Telemetry); err == nil {
+			telemetry = b
+			flags |= vehicleTelemetry
+		}
+	}
+	w.u8(flags)
+	w.str(v.Name)
+	w.str(v.Kind)
+	if flags&vehicleBody != 0 {
+		w.attitude(v.Body)
+	}
+	w.uvarint(uint64(len(v.Tires)))
+	for _, t := range v.Tires {
+		w.attitude(t)
+	}
+	if telemetry != nil {
+		w.str(string(telemetry))
+	}
+}
+
+type reader struct {
+	b   []byte
+	err error
+}
+
+func (r *reader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.b) {
+		r.err = ErrShortMessage
+		r.b = nil
+		return nil
+	}
+	p := r.b[:n]
+	r.b = r.b[n:]
+	return p
+}
+
+func (r *reader) u8() byte {
+	if p := r.next(1); p != nil {
+		return p[0]
+	}
+	return 0
+}
+
+func (r *reader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	x, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		r.err = ErrShortMessage
+		r.b = nil
+		return 0
+	}
+	r.b = r.b[n:]
+	return x
+}
+
+// count reads a length, bounded by the bytes left so a corrupt message
+// cannot make the decoder allocate more than it holds.
+func (r *reader) count() int {
+	n := r.uvarint()
+	if n > uint64(len(r.b)) {
+		r.err = ErrShortMessage
+		r.b = nil
+		return 0
+	}
+	return int(n)
+}
+
+func (r *reader) str() string {
+	return string(r.next(r.count()))
+}
+
+func (r *reader) u32() uint32 {
+	if p := r.next(4); p != nil {
+		return binary.LittleEndian.Uint32(p)
+	}
+	return 0
+}
+
+func (r *reader) f32() float64 {
+	return float64(math.Float32frombits(r.u32()))
+}
+
+func (r *reader) axis() float64 {
+	if p := r.next(2); p != nil {
+		return float64(int16(binary.LittleEndian.Uint16(p))) / math.MaxInt16
+	}
+	return 0
+}
+
+func (r *reader) attitude() Attitude {
+	a := Attitude{Position: make([]float64, 3)}
+	for i := range a.Position {
+		a.Position[i] = float64(int32(r.u32())) * PositionStep
+	}
+	a.Quaternion = UnpackQuaternion(r.u32())
+	return a
+}
+
+func (r *reader) vehicle() *Vehicle {
+	flags := r.u8()
+	v := &Vehicle{
+		Name:       r.str(),
+		Kind:       r.str(),
+		Sleeping:   flags&vehicleSleeping != 0,
+		SignalLost: flags&vehicleSignalLost != 0,
+	}
+	if flags&vehicleBody != 0 {
+		v.Body = r.attitude()
+	}
+	for n := r.count(); n > 0; n-- {
+		v.Tires = append(v.Tires, r.attitude())
+	}
+	if flags&vehicleTelemetry != 0 {
+		if b := r.next(r.count()); b != nil {
+			v.Telemetry = &Telemetry{}
+			if err := json.Unmarshal(b, v.Telemetry); err != nil && r.err == nil {
+				r.err = err
+			}
+		}
+	}
+	return v
+}
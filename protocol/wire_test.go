@@ -0,0 +1,125 @@
+package protocol
+
+import (
+	"bytes"
+	"math"
+	"net"
+	"net/rpc"
+	"testing"
+)
+
+func TestQuaternion(t *testing.T) {
+	for _, q := range [][]float64{
+		{1, 0, 0, 0},
+		{0, 0, 0, -1},
+		{0.5, -0.5, 0.5, -0.5},
+		{math.Cos(0.3), 0, 0, math.Sin(0.3)},
+		{0.1, 0.7, -0.2, 0.677},
+	} {
+		l := math.Sqrt(q[0]*q[0] + q[1]*q[1] + q[2]*q[2] + q[3]*q[3])
+		got := UnpackQuaternion(PackQuaternion(q))
+		// q and -q are the same rotation
+		dot := 0.0
+		for i := range q {
+			dot += q[i] / l * got[i]
+		}
+		if math.Abs(dot) < 1-1e-5 {
+			t.Errorf("%v: got %v", q, got)
+		}
+	}
+}
+
+func TestOutputRoundTrip(t *testing.T) {
+	body := Attitude{Position: []float64{1.23456, -0.5, 0.0341}, Quaternion: []float64{0.5, -0.5, 0.5, -0.5}}
+	out := &Output{
+		Self: &Vehicle{Name: "p", Body: body, Tires: []Attitude{body, body}, Telemetry: &Telemetry{Signal: 0.75}},
+		Others: []*Vehicle{
+			{Name: "q", Kind: KindQuadcopter, Body: body, SignalLost: true},
+			{Name: "r", Sleeping: true},
+		},
+		Objects:    []*Object{{Name: "cone", Shape: "cylinder", Size: []float64{0.05, 0.05, 0.1}, Body: body}},
+		Kinematics: []*Kinematic{{Name: "gate", Body: body}},
+		TimeScale:  0.5,
+		Paused:     true,
+	}
+	b := AppendOutput(nil, out)
+	got := &Output{}
+	if err := DecodeOutput(b, got); err != nil {
+		t.Fatal(err)
+	}
+	if got.TimeScale != 0.5 || !got.Paused || got.Self == nil || len(got.Others) != 2 || len(got.Objects) != 1 || len(got.Kinematics) != 1 {
+		t.Fatalf("decoded: %+v", got)
+	}
+	if p := got.Self.Body.Position; math.Abs(p[0]-1.23456) > PositionStep || math.Abs(p[2]-0.0341) > PositionStep {
+		t.Errorf("position: %v", p)
+	}
+	if got.Self.Telemetry == nil || got.Self.Telemetry.Signal != 0.75 || len(got.Self.Tires) != 2 {
+		t.Errorf("self: %+v", got.Self)
+	}
+	if q, r := got.Others[0], got.Others[1]; q.Kind != KindQuadcopter || !q.SignalLost || !r.Sleeping || r.Body.Position != nil {
+		t.Errorf("others: %+v %+v", q, r)
+	}
+	if s := got.Objects[0].Size; len(s) != 3 || math.Abs(s[2]-0.1) > 1e-6 {
+		t.Errorf("size: %v", s)
+	}
+	if err := DecodeOutput(b[:len(b)-1], got); err != ErrShortMessage {
+		t.Errorf("truncated: %v", err)
+	}
+}
+
+type echo struct{}
+
+func (echo) Update(in *Input, out *Output) error {
+	out.Self = &Vehicle{Name: in.Name, Body: Attitude{Position: []float64{in.Steering, in.Accel, 0}}}
+	return nil
+}
+
+func (echo) Name(in string, out *string) error {
+	*out = in
+	return nil
+}
+
+func TestCodec(t *testing.T) {
+	s := rpc.NewServer()
+	s.RegisterName("World", echo{})
+	a, b := net.Pipe()
+	go s.ServeCodec(NewServerCodec(a))
+	c := rpc.NewClientWithCodec(NewClientCodec(b))
+	defer c.Close()
+	res := &Output{}
+	if err := c.Call("World.Update", Input{Name: "p", Steering: -0.5, Accel: 1}, &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Self == nil || res.Self.Name != "p" || math.Abs(res.Self.Body.Position[0]+0.5) > 1e-4 {
+		t.Fatalf("update: %+v", res.Self)
+	}
+	var name string
+	if err := c.Call("World.Name", "q", &name); err != nil || name != "q" {
+		t.Fatalf("json body: %q %v", name, err)
+	}
+	if err := c.Call("World.Missing", "q", &name); err == nil {
+		t.Fatal("unknown method succeeded")
+	}
+}
+
+func TestMessages(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteMessage(&buf, Input{Name: "p", Steering: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteMessage(&buf, &Output{TimeScale: 1}); err != nil {
+		t.Fatal(err)
+	}
+	r := NewMessageReader(&buf)
+	var in Input
+	if err := r.Read(&in); err != nil || in.Name != "p" || in.Steering != 1 {
+		t.Fatalf("input: %+v %v", in, err)
+	}
+	var out Output
+	if err := r.Read(&out); err != nil || out.TimeScale != 1 {
+		t.Fatalf("output: %+v %v", out, err)
+	}
+	if err := r.Read(&out); err == nil {
+		t.Fatal("read past the end")
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/nobonobo/rccargo/protocol"
+)
+
+var (
+	pushRate  = flag.Float64("push-rate", 30, "state broadcast rate of /push connections, Hz (0 disables them)")
+	pushQueue = flag.Int("push-queue", 4, "states queued per /push connection before the oldest is dropped")
+)
+
+// subscriber is a /push connection. The physics loop only hands it frames;
+// its own goroutine builds, encodes and writes them, so a slow client only
+// loses states and never holds up the physics or the others. States are
+// sent in full, sleeping vehicles included, so losing one loses nothing.
+type subscriber struct {
+	mu      sync.Mutex
+	name    string // player, from the first input; no states before it
+	frames  chan *frame
+	dropped int // physics goroutine only
+}
+
+func (s *subscriber) player() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.name
+}
+
+// offer queues f, dropping the oldest queued frame when the queue is
+// full. Only the physics goroutine offers, so offers never race each
+// other.
+func (s *subscriber) offer(f *frame) {
+	for {
+		select {
+		case s.frames <- f:
+			return
+		default:
+		}
+		select {
+		case <-s.frames:
+			s.dropped++
+		default:
+		}
+	}
+}
+
+// subscribers are the /push connections. Their lock is held only to hand
+// out frames, never while building or writing states.
+type subscribers struct {
+	mu  sync.Mutex
+	set map[*subscriber]bool
+}
+
+func (ss *subscribers) add(s *subscriber) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.set == nil {
+		ss.set = map[*subscriber]bool{}
+	}
+	ss.set[s] = true
+}
+
+// remove returns the frames s dropped.
+func (ss *subscribers) remove(s *subscriber) int {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	delete(ss.set, s)
+	return s.dropped
+}
+
+// handlePush serves a /push connection: the client sends input messages
+// when its controls change, the server the world at pushRate.
+func (w *World) handlePush(ws *websocket.Conn) {
+	log.Println("push connect:", ws.Request().RemoteAddr)
+	defer log.Println("push disconnect:", ws.Request().RemoteAddr)
+	ws.PayloadType = websocket.BinaryFrame
+	size := *pushQueue
+	if size < 1 {
+		size = 1
+	}
+	s := &subscriber{frames: make(chan *frame, size)}
+	w.subscribers.add(s)
+	done := make(chan struct{})
+	defer func() {
+		if n := w.subscribers.remove(s); n > 0 {
+			log.Println("push dropped:", s.player(), n)
+		}
+		close(done)
+	}()
+	go func() {
+		for {
+			select {
+			case f := <-s.frames:
+				name := s.player()
+				if name == "" {
+					continue
+				}
+				out := &protocol.Output{}
+				f.output(name, nil, out)
+				b, err := protocol.EncodeMessage(out)
+				if err != nil {
+					log.Println("push:", err)
+					continue
+				}
+				if _, err := ws.Write(b); err != nil {
+					ws.Close()
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	r := protocol.NewMessageReader(ws)
+	for {
+		var in protocol.Input
+		if err := r.Read(&in); err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.name = in.Name
+		s.mu.Unlock()
+		w.receive(&in)
+	}
+}
+
+// broadcast hands the last frame to every /push connection. It runs on
+// the physics goroutine.
+func (w *World) broadcast() {
+	f := w.frame.Load().(*frame)
+	w.subscribers.mu.Lock()
+	defer w.subscribers.mu.Unlock()
+	for s := range w.subscribers.set {
+		s.offer(f)
+	}
+}
+
+// pushEvery returns the physics ticks of step between broadcasts.
+func pushEvery(step time.Duration) int {
+	if *pushRate <= 0 {
+		return 0
+	}
+	n := int(time.Duration(float64(time.Second) / *pushRate) / step)
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
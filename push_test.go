@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/nobonobo/rccargo/protocol"
+)
+
+func TestPush(t *testing.T) {
+	w := newTestWorld(t, "p1", "p2")
+	w.ctx.ResetVehicle("p2", []float64{2, 1, 0.5})
+	srv := httptest.NewServer(websocket.Handler(w.handlePush))
+	defer srv.Close()
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/", "", srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	if err := protocol.WriteMessage(ws, protocol.Input{Name: "p2"}); err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			w.Update(&protocol.Input{Name: "p1", Telemetry: true}, &protocol.Output{})
+			w.tick(10 * time.Millisecond)
+			w.broadcast()
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	ws.SetReadDeadline(time.Now().Add(10 * time.Second))
+	r := protocol.NewMessageReader(ws)
+	for {
+		out := &protocol.Output{}
+		if err := r.Read(out); err != nil {
+			t.Fatal("no state with p1 asleep:", err)
+		}
+		if out.Self == nil || out.Self.Name != "p2" || len(out.Others) != 1 {
+			t.Fatalf("state: %+v", out)
+		}
+		p1 := out.Others[0]
+		if p1.Telemetry != nil {
+			t.Fatal("telemetry of p1 pushed to p2")
+		}
+		if p1.Sleeping {
+			// sent in full, a dropped state cannot leave a stub behind
+			if len(p1.Body.Position) != 3 {
+				t.Fatalf("sleeping p1 sent without its pose: %+v", p1)
+			}
+			return
+		}
+	}
+}
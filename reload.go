@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/nobonobo/rccargo/physics"
+	"github.com/nobonobo/rccargo/protocol"
+)
+
+var profileFile = flag.String("profile", "./profile.json", "profile path")
+
+// loadProfile reads, upgrades and validates filename.
+func loadProfile(filename string) (protocol.Profile, error) {
+	fp, err := os.Open(filename)
+	if err != nil {
+		return protocol.DefaultProfile(), err
+	}
+	defer fp.Close()
+	return protocol.DecodeProfile(fp)
+}
+
+// printProfileErrors prints one line per problem and returns the exit status.
+func printProfileErrors(err error) int {
+	if err == nil {
+		fmt.Println("profile ok")
+		return 0
+	}
+	if errs, ok := err.(protocol.ValidationError); ok {
+		for _, e := range errs {
+			fmt.Println(e)
+		}
+	} else {
+		fmt.Println(err)
+	}
+	return 1
+}
+
+// diffProfile lists the fields that differ between a and b as "path: a -> b".
+func diffProfile(path string, a, b reflect.Value) []string {
+	if a.Kind() == reflect.Struct {
+		res := []string{}
+		for i := 0; i < a.NumField(); i++ {
+			name := a.Type().Field(i).Name
+			if path != "" {
+				name = path + "." + name
+			}
+			res = append(res, diffProfile(name, a.Field(i), b.Field(i))...)
+		}
+		return res
+	}
+	if reflect.DeepEqual(a.Interface(), b.Interface()) {
+		return nil
+	}
+	return []string{fmt.Sprintf("%s: %v -> %v", path, a.Interface(), b.Interface())}
+}
+
+// watchProfile polls filename and applies changes to the running context.
+func watchProfile(ctx physics.World, filename string, interval time.Duration) {
+	var last time.Time
+	if fi, err := os.Stat(filename); err == nil {
+		last = fi.ModTime()
+	}
+	for range time.Tick(interval) {
+		fi, err := os.Stat(filename)
+		if err != nil || !fi.ModTime().After(last) {
+			continue
+		}
+		last = fi.ModTime()
+		profile, err := loadProfile(filename)
+		diff := diffProfile("", reflect.ValueOf(ctx.GetProfile()), reflect.ValueOf(profile))
+		if err != nil {
+			log.Println("profile rejected:", err)
+			for _, d := range diff {
+				log.Println("  ", d)
+			}
+			continue
+		}
+		if len(diff) == 0 {
+			continue
+		}
+		log.Println("profile reload:")
+		for _, d := range diff {
+			log.Println("  ", d)
+		}
+		ctx.ApplyProfile(profile)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/nobonobo/rccargo/protocol"
+)
+
+// session is the World service of one /ws connection. Players joined over
+// it are owned by it: only it drains their sensor readings.
+type session struct {
+	*World
+}
+
+func newSession(w *World) *session {
+	return &session{World: w}
+}
+
+// Join joins with a car.
+func (s *session) Join(name string, rep *protocol.VehicleProfile) error {
+	if err := s.World.Join(name, rep); err != nil {
+		return err
+	}
+	s.own(name)
+	return nil
+}
+
+// JoinAs joins with a vehicle of the requested kind.
+func (s *session) JoinAs(req *protocol.Join, rep *protocol.Profile) error {
+	if err := s.World.JoinAs(req, rep); err != nil {
+		return err
+	}
+	s.own(req.Name)
+	return nil
+}
+
+func (s *session) own(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.owners[name] = s
+}
+
+// Sensors returns the IMU, wheel encoder and GPS readings of the player's
+// vehicle taken since the previous call. Only the connection the player
+// joined on gets them.
+func (s *session) Sensors(name string, rep *protocol.Sensors) error {
+	s.mu.Lock()
+	owner := s.owners[name]
+	s.mu.Unlock()
+	if owner != s {
+		return fmt.Errorf("%s: not joined on this connection", name)
+	}
+	v := s.ctx.GetVehicle(name)
+	if v == nil {
+		return fmt.Errorf("unknown name: %s", name)
+	}
+	*rep = *v.Sensors()
+	return nil
+}
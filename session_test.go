@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nobonobo/rccargo/protocol"
+)
+
+func TestSensorsOwner(t *testing.T) {
+	w := newTestWorld(t)
+	owner, other := newSession(w), newSession(w)
+	if err := owner.JoinAs(&protocol.Join{Name: "p1", Kind: protocol.KindCar}, &protocol.Profile{}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		w.tick(10 * time.Millisecond)
+	}
+	var s protocol.Sensors
+	if err := other.Sensors("p1", &s); err == nil {
+		t.Fatal("readings drained by another connection")
+	}
+	if err := owner.Sensors("p1", &s); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.IMU) == 0 {
+		t.Fatal("readings lost to the other connection")
+	}
+	w.gc("p1")
+	if err := other.Join("p1", &protocol.VehicleProfile{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := owner.Sensors("p1", &s); err == nil {
+		t.Fatal("readings of a new player with the same name drained by the old owner")
+	}
+}